@@ -1,20 +1,71 @@
 package entry
 
 import (
+	"context"
 	"fmt"
 	"groupie/geocoding"
 	api "groupie/handlers"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"time"
 )
 
+// how often the artist data is re-downloaded, if GROUPIE_REFRESH_INTERVAL isn't set
+const defaultRefreshInterval = time.Hour
+
 func Start() {
 
-	var err error
-	api.Artists, api.RelationData, err = api.LoadArtistData()
+	refreshInterval, err := refreshIntervalFromEnv()
+	if err != nil {
+		log.Fatal("Critical error on init: ", err.Error())
+	}
+
+	err = fuzzyRulesFromEnv()
+	if err != nil {
+		log.Fatal("Critical error on init: ", err.Error())
+	}
+
+	err = adminAccessFromEnv()
+	if err != nil {
+		log.Fatal("Critical error on init: ", err.Error())
+	}
+
+	geocoder, persistMarkers, err := geocoderFromEnv()
+	if err != nil {
+		log.Fatal("Critical error on init: ", err.Error())
+	}
+	geocoding.SetProvider(geocoder)
+	log.Println("Geocoding with", geocoder.Name())
+
+	//geocoding data goes first, so the radius filter and the map have the known markers from the first request on
+	err = geocoding.LoadGeocodeData()
+	if err != nil {
+		fmt.Println("ERROR: failed to load geocoding data:", err)
+	}
+
+	source, err := dataSourceFromEnv()
 	if err != nil {
 		log.Fatal("Critical error on init: ", err.Error())
 	}
+	log.Println("Loading artist data from", source.Name())
+
+	data, err := api.LoadArtistData(source)
+	if err != nil {
+		log.Fatal("Critical error on init: ", err.Error())
+	}
+	api.SetData(data)
+	if len(data.Rejected) > 0 {
+		log.Printf("WARNING: %d records rejected, see /admin/rejected\n", len(data.Rejected))
+	}
+	if len(data.Quality.Issues) > 0 {
+		log.Printf("WARNING: %d data quality issues, see /data-quality\n", len(data.Quality.Issues))
+	}
+
+	if refreshInterval > 0 {
+		go api.DataRefresher(source, refreshInterval)
+	}
 
 	http.Handle("/templates/", http.StripPrefix("/templates/", http.FileServer(http.Dir("../templates"))))
 	// http.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.Dir("../images"))))
@@ -23,13 +74,17 @@ func Start() {
 	http.HandleFunc("/search", api.SuggestionsHandler)
 	http.HandleFunc("/map", api.MapHandler)
 	http.HandleFunc("/markerHandler", api.MarkerHandler)
+	http.HandleFunc("/data-quality", api.DataQualityHandler)
+	http.HandleFunc("/admin/rejected", api.AdminOnly(api.RejectedHandler))
+	http.HandleFunc("GET /admin/geocoding", api.AdminOnly(api.GeocodingStatsHandler))
 
-	err = geocoding.LoadGeocodeData()
-	if err != nil {
-		fmt.Println("ERROR: failed to load geocoding data:", err)
+	api.RegisterAPI(http.DefaultServeMux)
+
+	if persistMarkers {
+		go geocoding.GeocodeLogger()
 	}
-	go geocoding.GeocodeLogger()
-	go geocoding.GeocodeDownloader()
+	go geocoding.GeocodeDownloader(context.Background())
+	go geocoding.FailureRetrier()
 
 	log.Println("Server running on :8080")
 	err = http.ListenAndServe(":8080", nil)
@@ -37,3 +92,87 @@ func Start() {
 		fmt.Println("ERROR: ", err)
 	}
 }
+
+// reads the refresh interval from GROUPIE_REFRESH_INTERVAL, like "30m" or "2h", "0" turns refreshing off
+func refreshIntervalFromEnv() (time.Duration, error) {
+	value := os.Getenv("GROUPIE_REFRESH_INTERVAL")
+	if value == "" {
+		return defaultRefreshInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("bad GROUPIE_REFRESH_INTERVAL %q", value)
+	}
+	return interval, nil
+}
+
+// uses the JSON files in GROUPIE_DATA_DIR if it's set, otherwise the upstream API.
+// GROUPIE_FETCH_TIMEOUT, like "5s", sets the timeout of a single request to the upstream API
+func dataSourceFromEnv() (api.DataSource, error) {
+	dir := os.Getenv("GROUPIE_DATA_DIR")
+	if dir != "" {
+		return api.DirSource{Dir: dir}, nil
+	}
+
+	source := api.UpstreamSource()
+	value := os.Getenv("GROUPIE_FETCH_TIMEOUT")
+	if value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("bad GROUPIE_FETCH_TIMEOUT %q", value)
+		}
+		source.Timeout = timeout
+	}
+	return source, nil
+}
+
+// reads how many typos search allows from GROUPIE_FUZZY_DISTANCES, "length:distance" pairs like "4:1,8:2"
+func fuzzyRulesFromEnv() error {
+	value := os.Getenv("GROUPIE_FUZZY_DISTANCES")
+	if value == "" {
+		return nil
+	}
+	rules, err := api.ParseFuzzyRules(value)
+	if err != nil {
+		return fmt.Errorf("bad GROUPIE_FUZZY_DISTANCES: %v", err)
+	}
+	api.FuzzyRules = rules
+	return nil
+}
+
+// reads who can see the admin pages from GROUPIE_ADMIN: "local" (the default) for requests from this machine only,
+// "public" for everyone or "off" for nobody
+func adminAccessFromEnv() error {
+	value := os.Getenv("GROUPIE_ADMIN")
+	if value == "" {
+		return nil
+	}
+	access, err := api.ParseAdminAccess(value)
+	if err != nil {
+		return fmt.Errorf("bad GROUPIE_ADMIN: %v", err)
+	}
+	api.AdminAccess = access
+	return nil
+}
+
+// picks the geocoder: the Nominatim server at GROUPIE_GEOCODER_URL, the public one if it's not set,
+// or with GROUPIE_GEOCODER=offline one that makes up coordinates, for running without network access.
+// Made up markers aren't saved, so they don't end up in geodata/geodata.json
+func geocoderFromEnv() (geocoding.Provider, bool, error) {
+	switch kind := os.Getenv("GROUPIE_GEOCODER"); kind {
+	case "", "nominatim":
+	case "offline":
+		return geocoding.Offline{}, false, nil
+	default:
+		return nil, false, fmt.Errorf(`bad GROUPIE_GEOCODER %q, must be "nominatim" or "offline"`, kind)
+	}
+
+	baseURL := os.Getenv("GROUPIE_GEOCODER_URL")
+	if baseURL == "" {
+		return geocoding.NewNominatim(geocoding.DefaultNominatimURL), true, nil
+	}
+	if parsed, err := url.Parse(baseURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, false, fmt.Errorf("bad GROUPIE_GEOCODER_URL %q", baseURL)
+	}
+	return geocoding.NewNominatim(baseURL), true, nil
+}
@@ -0,0 +1,148 @@
+package geocoding
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"groupie/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// This joints the path using platform correct symbols, / for linux \ for windows etc.
+var filePath = filepath.Join("..", "geodata", "geodata.json")
+
+// the old "location, lon, lat" text cache. It's the cache the repository ships, migrated to filePath whenever there's no filePath yet
+var legacyFilePath = filepath.Join("..", "geodata", "geodata.txt")
+
+// bump this whenever the layout of the cache file changes. Files newer than this are set aside, not overwritten
+const geocodeFileVersion = 1
+
+// on-disk layout of the cache file
+type geocodeFileT struct {
+	Version int             `json:"version"`
+	Markers []geocodeRecord `json:"markers"` // ordered by location, so the file diffs well
+}
+
+// a cached marker as it's saved
+type geocodeRecord struct {
+	Location    string    `json:"location"` // location key, "osaka-japan"
+	Latitude    string    `json:"lat"`
+	Longitude   string    `json:"lon"`
+	Class       string    `json:"class,omitempty"`
+	Addresstype string    `json:"addresstype,omitempty"`
+	Source      string    `json:"source"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+}
+
+// Loads geocode data from file, migrating the old text file if that's all there is.
+// A file that can't be read is set aside under a name ending in ".bad", so the next save doesn't overwrite it
+func LoadGeocodeData() error {
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return migrateLegacyGeocodeData()
+	} else if err != nil {
+		return err
+	}
+
+	file := geocodeFileT{}
+	err = json.Unmarshal(data, &file)
+	if err == nil && (file.Version < 1 || file.Version > geocodeFileVersion) {
+		err = fmt.Errorf("version %d is not supported, expected %d", file.Version, geocodeFileVersion)
+	}
+	if err != nil {
+		//stamped with the time, so a file set aside earlier isn't overwritten either
+		badPath := fmt.Sprintf("%s.%s.bad", filePath, time.Now().UTC().Format("20060102T150405.000000000"))
+		if renameErr := os.Rename(filePath, badPath); renameErr != nil {
+			return fmt.Errorf("unreadable geocode cache %s: %v, and it couldn't be set aside: %v", filePath, err, renameErr)
+		}
+		return fmt.Errorf("unreadable geocode cache, moved to %s: %v", badPath, err)
+	}
+
+	for _, record := range file.Markers {
+		if record.Location == "" || record.Latitude == "" || record.Longitude == "" {
+			continue
+		}
+		GeocodingCache.set(record.Location, Marker{
+			Latitude:    record.Latitude,
+			Longitude:   record.Longitude,
+			Class:       record.Class,
+			Addresstype: record.Addresstype,
+			Source:      record.Source,
+			FetchedAt:   record.FetchedAt,
+		})
+	}
+	return nil
+}
+
+// reads the old text file into the cache and saves it in the new format. Broken lines are skipped.
+// The text file is left as it is, it's only read again if the new file goes missing
+func migrateLegacyGeocodeData() error {
+	info, err := os.Stat(legacyFilePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(legacyFilePath)
+	if err != nil {
+		return err
+	}
+
+	//the text file didn't know when its markers were fetched, they were fetched before it was last written at least
+	fetchedAt := info.ModTime().UTC()
+	skipped := 0
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r", ""), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, ", ")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			skipped++
+			continue
+		}
+		GeocodingCache.set(parts[0], Marker{Longitude: parts[1], Latitude: parts[2], Source: "geodata.txt", FetchedAt: fetchedAt})
+	}
+	if skipped > 0 {
+		fmt.Println("WARNING: skipped", skipped, "broken lines of", legacyFilePath)
+	}
+
+	err = SaveGeocodeData()
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s: %v", legacyFilePath, err)
+	}
+	fmt.Println("Migrated", legacyFilePath, "to", filePath)
+	return nil
+}
+
+// Saves geocode data into a file
+func SaveGeocodeData() error {
+	file := geocodeFileT{Version: geocodeFileVersion}
+
+	GeocodingCache.mutex.Lock() //the downloader keeps adding markers while this runs
+	for location, marker := range GeocodingCache.cache {
+		file.Markers = append(file.Markers, geocodeRecord{
+			Location:    location,
+			Latitude:    marker.Latitude,
+			Longitude:   marker.Longitude,
+			Class:       marker.Class,
+			Addresstype: marker.Addresstype,
+			Source:      marker.Source,
+			FetchedAt:   marker.FetchedAt,
+		})
+	}
+	GeocodingCache.mutex.Unlock()
+	slices.SortFunc(file.Markers, func(a, b geocodeRecord) int { return cmp.Compare(a.Location, b.Location) })
+
+	data, err := json.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	//a crash mid-write doesn't destroy the old cache
+	return utils.WriteFileAtomic(filePath, append(data, '\n'), 0644)
+}
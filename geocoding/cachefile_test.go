@@ -0,0 +1,207 @@
+package geocoding
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// points the cache files into a directory of the test's own and gives it an empty cache,
+// both are put back when the test ends. Returns the directory
+func useTempCacheFiles(t *testing.T) string {
+	dir := t.TempDir()
+	oldFilePath, oldLegacyFilePath, oldCache := filePath, legacyFilePath, GeocodingCache
+	filePath, legacyFilePath = filepath.Join(dir, "geodata.json"), filepath.Join(dir, "geodata.txt")
+	GeocodingCache = makeGC()
+	t.Cleanup(func() {
+		filePath, legacyFilePath, GeocodingCache = oldFilePath, oldLegacyFilePath, oldCache
+	})
+	return dir
+}
+
+// files in dir ending in ".bad"
+func badFiles(t *testing.T, dir string) []string {
+	bad, err := filepath.Glob(filepath.Join(dir, "*.bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bad
+}
+
+func TestLoadGeocodeData(t *testing.T) {
+	tests := []struct {
+		name    string
+		legacy  string // geodata.txt, "" for none
+		file    string // geodata.json, "" for none
+		wantErr bool
+		want    map[string][2]string // latitude and longitude by location
+	}{
+		{
+			name:   "legacy file is migrated",
+			legacy: "osaka-japan, 135.5023, 34.6937\nberlin-germany, 13.4050, 52.5200\n",
+			want:   map[string][2]string{"osaka-japan": {"34.6937", "135.5023"}, "berlin-germany": {"52.5200", "13.4050"}},
+		},
+		{
+			name:   "broken legacy lines are skipped",
+			legacy: "osaka-japan, 135.5023, 34.6937\nno commas here\n, 1, 2\nberlin-germany, 13.4050\r\n\nlima-peru, -77.0428, -12.0464\r\nparis-france, 2.35, 48.85, extra\n",
+			want:   map[string][2]string{"osaka-japan": {"34.6937", "135.5023"}, "lima-peru": {"-12.0464", "-77.0428"}},
+		},
+		{
+			name: "nothing to load",
+			want: map[string][2]string{},
+		},
+		{
+			name: "current file",
+			file: `{"version": 1, "markers": [{"location": "osaka-japan", "lat": "34.6937", "lon": "135.5023", "source": "test"}, {"location": "nowhere-land", "lat": ""}]}`,
+			want: map[string][2]string{"osaka-japan": {"34.6937", "135.5023"}},
+		},
+		{
+			name:   "current file wins over the legacy one",
+			legacy: "berlin-germany, 13.4050, 52.5200\n",
+			file:   `{"version": 1, "markers": [{"location": "osaka-japan", "lat": "34.6937", "lon": "135.5023", "source": "test"}]}`,
+			want:   map[string][2]string{"osaka-japan": {"34.6937", "135.5023"}},
+		},
+		{
+			name:    "unreadable file",
+			file:    `{"version": 1, "markers": [`,
+			wantErr: true,
+			want:    map[string][2]string{},
+		},
+		{
+			name:    "newer version",
+			file:    `{"version": 2, "markers": [{"location": "osaka-japan", "lat": "34.6937", "lon": "135.5023"}]}`,
+			wantErr: true,
+			want:    map[string][2]string{},
+		},
+		{
+			name:    "no version",
+			file:    `{"markers": []}`,
+			wantErr: true,
+			want:    map[string][2]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := useTempCacheFiles(t)
+			if test.legacy != "" {
+				if err := os.WriteFile(legacyFilePath, []byte(test.legacy), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.file != "" {
+				if err := os.WriteFile(filePath, []byte(test.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := LoadGeocodeData()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error %v, want one: %v", err, test.wantErr)
+			}
+
+			if size := GeocodingCache.size(); size != len(test.want) {
+				t.Errorf("%d markers cached, want %d", size, len(test.want))
+			}
+			for location, coordinates := range test.want {
+				marker, ok := GeocodingCache.get(location)
+				if !ok || marker.Latitude != coordinates[0] || marker.Longitude != coordinates[1] {
+					t.Errorf("%s: %+v, want %s, %s", location, marker, coordinates[0], coordinates[1])
+				}
+			}
+
+			bad := badFiles(t, dir)
+			if test.wantErr {
+				//set aside as it was, so nothing overwrites it
+				if len(bad) != 1 {
+					t.Fatalf("set aside files %q, want 1", bad)
+				}
+				if data, _ := os.ReadFile(bad[0]); string(data) != test.file {
+					t.Errorf("set aside %q, want %q", data, test.file)
+				}
+				if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+					t.Errorf("the unreadable file is still in place: %v", err)
+				}
+			} else if len(bad) != 0 {
+				t.Errorf("set aside files %q", bad)
+			}
+
+			if test.legacy != "" && test.file == "" {
+				//migrated into the new file, the shipped text file is left alone
+				if data, err := os.ReadFile(legacyFilePath); err != nil || string(data) != test.legacy {
+					t.Errorf("legacy file after migrating: %q, %v", data, err)
+				}
+				GeocodingCache = makeGC()
+				if err := LoadGeocodeData(); err != nil || GeocodingCache.size() != len(test.want) {
+					t.Errorf("loading the migrated file: %d markers, %v", GeocodingCache.size(), err)
+				}
+			}
+		})
+	}
+}
+
+// a second unreadable file doesn't overwrite the first one set aside
+func TestLoadGeocodeDataKeepsBadFiles(t *testing.T) {
+	dir := useTempCacheFiles(t)
+
+	for i, content := range []string{"first", "second"} {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadGeocodeData(); err == nil {
+			t.Fatalf("%s file loaded", content)
+		}
+		if bad := badFiles(t, dir); len(bad) != i+1 {
+			t.Fatalf("after the %s file set aside files %q", content, bad)
+		}
+	}
+
+	contents := []string{}
+	for _, path := range badFiles(t, dir) {
+		data, _ := os.ReadFile(path)
+		contents = append(contents, string(data))
+	}
+	if joined := strings.Join(contents, ", "); joined != "first, second" {
+		t.Errorf("set aside %s", joined)
+	}
+}
+
+func TestSaveGeocodeDataRoundTrip(t *testing.T) {
+	useTempCacheFiles(t)
+
+	fetchedAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	markers := map[string]Marker{
+		"osaka-japan":    {Latitude: "34.6937", Longitude: "135.5023", Class: "place", Addresstype: "city", Source: "nominatim", FetchedAt: fetchedAt},
+		"berlin-germany": {Latitude: "52.5200", Longitude: "13.4050", Source: "geodata.txt", FetchedAt: fetchedAt.Add(time.Hour)},
+	}
+	for location, marker := range markers {
+		GeocodingCache.set(location, marker)
+	}
+	if err := SaveGeocodeData(); err != nil {
+		t.Fatal("saving:", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//sorted by location
+	if berlin, osaka := strings.Index(string(data), "berlin-germany"), strings.Index(string(data), "osaka-japan"); berlin < 0 || berlin > osaka {
+		t.Errorf("markers out of order:\n%s", data)
+	}
+
+	GeocodingCache = makeGC()
+	if err := LoadGeocodeData(); err != nil {
+		t.Fatal("loading:", err)
+	}
+	if size := GeocodingCache.size(); size != len(markers) {
+		t.Errorf("%d markers loaded, want %d", size, len(markers))
+	}
+	for location, want := range markers {
+		if marker, ok := GeocodingCache.get(location); !ok || marker != want {
+			t.Errorf("%s: %+v, want %+v", location, marker, want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package geocoding
+
+import (
+	"math"
+	"strconv"
+)
+
+const earthRadiusKm = 6371.0
+
+// parsed coordinates of a marker, ok is false if the marker is empty or broken
+func (marker Marker) Coordinates() (float64, float64, bool) {
+	latitude, latErr := strconv.ParseFloat(marker.Latitude, 64)
+	longitude, lonErr := strconv.ParseFloat(marker.Longitude, 64)
+	if latErr != nil || lonErr != nil {
+		return 0, 0, false
+	}
+	return latitude, longitude, true
+}
+
+// great-circle distance between two points in kilometres, using the haversine formula
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,122 @@
+package geocoding
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// how long a failed location rests before it's looked up again, doubling with every failure in a row.
+// FailureRetrier queues it again once the time is up
+type RetryPolicy struct {
+	First time.Duration // cool-down after the first failure
+	Max   time.Duration // longest cool-down
+}
+
+// the cool-down after the given number of failures in a row
+func (policy RetryPolicy) coolDown(attempts int) time.Duration {
+	coolDown := policy.First
+	for i := 1; i < attempts && coolDown < policy.Max; i++ {
+		coolDown *= 2
+	}
+	return min(coolDown, policy.Max)
+}
+
+var (
+	NotFoundRetry = RetryPolicy{First: time.Hour, Max: 7 * 24 * time.Hour} // the geocoder has no results, that rarely changes
+	ErrorRetry    = RetryPolicy{First: time.Minute, Max: time.Hour}        // the request failed, probably a network or server problem
+)
+
+// a location that couldn't be geocoded, and when it's looked up again
+type Failure struct {
+	Err      error     // ErrNotFound or the provider's error
+	FailedAt time.Time // the last failure
+	Attempts int       // failures in a row
+	RetryAt  time.Time // the location isn't looked up again before this
+}
+
+// failed locations, so they aren't looked up again on every map view
+type failureCacheT struct {
+	failures map[string]Failure
+	mutex    sync.Mutex
+}
+
+var failureCache = &failureCacheT{failures: make(map[string]Failure)}
+
+// records a failed lookup, the cool-down grows with every failure in a row
+func (FC *failureCacheT) record(location string, err error, now time.Time) Failure {
+	FC.mutex.Lock()
+	defer FC.mutex.Unlock()
+
+	policy := ErrorRetry
+	if errors.Is(err, ErrNotFound) {
+		policy = NotFoundRetry
+	}
+	failure := Failure{Err: err, FailedAt: now, Attempts: FC.failures[location].Attempts + 1}
+	failure.RetryAt = now.Add(policy.coolDown(failure.Attempts))
+	FC.failures[location] = failure
+	return failure
+}
+
+// the location's failure if it's still cooling down
+func (FC *failureCacheT) coolingDown(location string, now time.Time) (Failure, bool) {
+	FC.mutex.Lock()
+	defer FC.mutex.Unlock()
+
+	failure, ok := FC.failures[location]
+	return failure, ok && now.Before(failure.RetryAt)
+}
+
+// the locations whose cool-down is over
+func (FC *failureCacheT) due(now time.Time) []string {
+	FC.mutex.Lock()
+	defer FC.mutex.Unlock()
+
+	locations := []string{}
+	for location, failure := range FC.failures {
+		if !now.Before(failure.RetryAt) {
+			locations = append(locations, location)
+		}
+	}
+	return locations
+}
+
+func (FC *failureCacheT) forget(location string) {
+	FC.mutex.Lock()
+	delete(FC.failures, location)
+	FC.mutex.Unlock()
+}
+
+func (FC *failureCacheT) size() int {
+	FC.mutex.Lock()
+	defer FC.mutex.Unlock()
+	return len(FC.failures)
+}
+
+// how often FailureRetrier looks for locations to retry
+const retryCheckInterval = time.Minute
+
+// queues failed locations in the background again once their cool-down is over,
+// so they're retried without waiting for someone to ask for them
+func FailureRetrier() {
+	for {
+		time.Sleep(retryCheckInterval)
+		for _, location := range failureCache.due(time.Now()) {
+			QueueLocation(location, PriorityBackground)
+		}
+	}
+}
+
+// why the location's last lookup failed, if it's still cooling down and won't be looked up before the error's RetryAt
+func RecentFailure(location string) (*GeocodeError, bool) {
+	failure, ok := failureCache.coolingDown(location, time.Now())
+	if !ok {
+		return nil, false
+	}
+	return &GeocodeError{Location: location, Err: failure.Err, RetryAt: failure.RetryAt}, true
+}
+
+// number of locations that couldn't be geocoded, cooling down or not
+func FailedCount() int {
+	return failureCache.size()
+}
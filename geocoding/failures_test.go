@@ -0,0 +1,59 @@
+package geocoding
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{First: time.Minute, Max: time.Hour}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	}
+	for _, test := range tests {
+		if got := policy.coolDown(test.attempts); got != test.want {
+			t.Errorf("%d attempts: %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestFailureCache(t *testing.T) {
+	failures := &failureCacheT{failures: make(map[string]Failure)}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	notFound := failures.record("nowhere-atlantis", ErrNotFound, start)
+	failures.record("broken-city", errors.New("timeout"), start)
+	failed := failures.record("broken-city", errors.New("timeout"), start)
+	if !notFound.RetryAt.Equal(start.Add(NotFoundRetry.First)) || !failed.RetryAt.Equal(start.Add(2*ErrorRetry.First)) {
+		t.Errorf("retry at %v and %v", notFound.RetryAt, failed.RetryAt)
+	}
+
+	if _, ok := failures.coolingDown("broken-city", start.Add(time.Minute)); !ok {
+		t.Error("broken-city isn't cooling down")
+	}
+	if due := failures.due(start.Add(time.Minute)); len(due) != 0 {
+		t.Errorf("due after a minute: %q", due)
+	}
+	if due := failures.due(start.Add(2 * time.Minute)); !slices.Equal(due, []string{"broken-city"}) {
+		t.Errorf("due after two minutes: %q", due)
+	}
+	due := failures.due(start.Add(NotFoundRetry.First))
+	slices.Sort(due)
+	if !slices.Equal(due, []string{"broken-city", "nowhere-atlantis"}) {
+		t.Errorf("due after an hour: %q", due)
+	}
+
+	failures.forget("broken-city")
+	if _, ok := failures.coolingDown("broken-city", start); ok || failures.size() != 1 {
+		t.Errorf("broken-city wasn't forgotten, %d failures", failures.size())
+	}
+}
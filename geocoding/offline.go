@@ -0,0 +1,29 @@
+package geocoding
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// makes up coordinates instead of looking them up, so the map and the radius filter work without network access.
+// The same location always lands on the same spot, which has nothing to do with where the location really is
+type Offline struct{}
+
+func (Offline) Name() string {
+	return "offline, made up coordinates"
+}
+
+func (Offline) Geocode(location string) (Marker, error) {
+	hash := fnv.New64a()
+	hash.Write([]byte(location))
+	sum := hash.Sum64()
+	latitude := float64(sum%140_000_000)/1_000_000 - 70         //-70 to 70
+	longitude := float64((sum>>32)%360_000_000)/1_000_000 - 180 //-180 to 180
+
+	return Marker{
+		Latitude:    fmt.Sprintf("%.7f", latitude),
+		Longitude:   fmt.Sprintf("%.7f", longitude),
+		Class:       "place",
+		Addresstype: "city",
+	}, nil
+}
@@ -0,0 +1,144 @@
+package geocoding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"groupie/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// public Nominatim instance, the default geocoder
+const DefaultNominatimURL = "https://nominatim.openstreetmap.org"
+
+// returned by providers when they have no coordinates for a location
+var ErrNotFound = errors.New("location not found")
+
+// looks up the coordinates of concert locations
+type Provider interface {
+	Geocode(location string) (Marker, error) // location key, "osaka-japan". ErrNotFound if there are no results
+	Name() string
+}
+
+// the provider the downloader uses, set with SetProvider
+var (
+	provider      Provider = NewNominatim(DefaultNominatimURL)
+	providerMutex sync.Mutex
+)
+
+// changes the provider, a running downloader uses it from its next download on
+func SetProvider(newProvider Provider) {
+	providerMutex.Lock()
+	provider = newProvider
+	providerMutex.Unlock()
+}
+
+func currentProvider() Provider {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	return provider
+}
+
+// geocodes through a Nominatim server, the public one or a self-hosted one
+type Nominatim struct {
+	BaseURL     string        // without the trailing slash, "https://nominatim.openstreetmap.org"
+	UserAgent   string        // required by the public instance
+	MinInterval time.Duration // shortest time between two requests, the public instance allows one per second
+	Client      *http.Client
+
+	mutex       sync.Mutex
+	lastRequest time.Time
+}
+
+func NewNominatim(baseURL string) *Nominatim {
+	return &Nominatim{
+		BaseURL:     strings.TrimSuffix(baseURL, "/"),
+		UserAgent:   "zone01Athens-groupie-tracker-v0.2 (aleksis.gioldaseas@outlook.com)",
+		MinInterval: time.Second,
+		Client:      &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (nominatim *Nominatim) Name() string {
+	return "nominatim at " + nominatim.BaseURL
+}
+
+// formats location for the search query, "osaka-japan" -> "japan, osaka"
+func nominatimQuery(location string) string {
+	city, country, _ := strings.Cut(location, "-")
+	query := strings.Join(utils.SplitByWords(country), "+") + ",+" + strings.Join(utils.SplitByWords(city), "+")
+	query = ManualLocationFixs(query)
+	return strings.ReplaceAll(query, "+", " ")
+}
+
+// waits until the next request is allowed
+func (nominatim *Nominatim) wait() {
+	nominatim.mutex.Lock()
+	defer nominatim.mutex.Unlock()
+
+	if wait := nominatim.MinInterval - time.Since(nominatim.lastRequest); wait > 0 {
+		time.Sleep(wait)
+	}
+	nominatim.lastRequest = time.Now()
+}
+
+func (nominatim *Nominatim) Geocode(location string) (Marker, error) {
+	nominatim.wait()
+
+	link := nominatim.BaseURL + "/search?" + url.Values{"q": {nominatimQuery(location)}, "format": {"json"}}.Encode()
+	request, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return Marker{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	// Set the User-Agent header to a unique identifier for your app, required by the api to work
+	request.Header.Set("User-Agent", nominatim.UserAgent)
+
+	startTime := time.Now()
+	response, err := nominatim.Client.Do(request)
+	if err != nil {
+		return Marker{}, fmt.Errorf("failed to fetch data: %v", err)
+	}
+	defer response.Body.Close()
+	fmt.Println("Downloaded marker for:", location, "it took", time.Since(startTime).Milliseconds(), "ms")
+
+	if response.StatusCode != http.StatusOK {
+		return Marker{}, fmt.Errorf("geocoder responded with %s", response.Status)
+	}
+
+	markers := []Marker{}
+	if err := json.NewDecoder(response.Body).Decode(&markers); err != nil {
+		return Marker{}, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	marker, ok := bestMarker(markers)
+	if !ok {
+		return Marker{}, ErrNotFound
+	}
+	return marker, nil
+}
+
+// picks the result that's most likely the concert's city: a city-like place, then a region, then whatever came first
+func bestMarker(markers []Marker) (Marker, bool) {
+	preferences := [][]string{
+		{"town", "village", "county", "municipality", "district", "city"},
+		{"state", "province", "region", "boundary"},
+	}
+	for _, kinds := range preferences {
+		for _, marker := range markers {
+			for _, kind := range kinds {
+				if marker.Class == kind || marker.Addresstype == kind {
+					return marker, marker.Latitude != "" && marker.Longitude != ""
+				}
+			}
+		}
+	}
+
+	if len(markers) > 0 {
+		return markers[0], markers[0].Latitude != "" && markers[0].Longitude != ""
+	}
+	return Marker{}, false
+}
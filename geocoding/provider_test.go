@@ -0,0 +1,240 @@
+package geocoding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a stand-in for a Nominatim server. It answers /search like Nominatim does, with coordinates made up from the query,
+// except queries containing "nowhere", which find nothing, and ones containing "broken", which fail
+type fakeNominatim struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []*http.Request
+}
+
+// starts the fake server, serving under prefix, closed when the test ends
+func newFakeNominatim(t *testing.T, prefix string) *fakeNominatim {
+	fake := &fakeNominatim{}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fake.mutex.Lock()
+		fake.requests = append(fake.requests, request)
+		fake.mutex.Unlock()
+
+		if request.URL.Path != prefix+"/search" {
+			http.NotFound(writer, request)
+			return
+		}
+		query := request.URL.Query().Get("q")
+		if strings.Contains(query, "broken") {
+			http.Error(writer, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+
+		results := []map[string]string{}
+		if !strings.Contains(query, "nowhere") {
+			marker, _ := Offline{}.Geocode(query)
+			//a region first, the city should still be picked
+			results = append(results,
+				map[string]string{"lat": "1", "lon": "2", "class": "boundary", "addresstype": "state"},
+				map[string]string{"lat": marker.Latitude, "lon": marker.Longitude, "class": "place", "addresstype": "city"})
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(results)
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// the requests the server got for a query
+func (fake *fakeNominatim) requestsFor(query string) []*http.Request {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	requests := []*http.Request{}
+	for _, request := range fake.requests {
+		if request.URL.Query().Get("q") == query {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func testNominatim(baseURL string) *Nominatim {
+	nominatim := NewNominatim(baseURL)
+	nominatim.MinInterval = 0
+	return nominatim
+}
+
+func TestNominatimGeocode(t *testing.T) {
+	fake := newFakeNominatim(t, "")
+	nominatim := testNominatim(fake.URL)
+
+	marker, err := nominatim.Geocode("osaka-japan")
+	if err != nil {
+		t.Fatal("osaka-japan:", err)
+	}
+	want, _ := Offline{}.Geocode("japan, osaka")
+	if marker.Latitude != want.Latitude || marker.Longitude != want.Longitude || marker.Addresstype != "city" {
+		t.Errorf("osaka-japan: %+v, want the city at %s, %s", marker, want.Latitude, want.Longitude)
+	}
+
+	requests := fake.requestsFor("japan, osaka")
+	if len(requests) != 1 {
+		t.Fatalf("%d requests for osaka-japan", len(requests))
+	}
+	if agent := requests[0].Header.Get("User-Agent"); agent != nominatim.UserAgent || agent == "" {
+		t.Errorf("User-Agent %q, want %q", agent, nominatim.UserAgent)
+	}
+	if format := requests[0].URL.Query().Get("format"); format != "json" {
+		t.Errorf("format %q", format)
+	}
+}
+
+func TestNominatimNotFound(t *testing.T) {
+	nominatim := testNominatim(newFakeNominatim(t, "").URL)
+
+	if _, err := nominatim.Geocode("nowhere-atlantis"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("nowhere-atlantis: %v, want ErrNotFound", err)
+	}
+}
+
+func TestNominatimServerError(t *testing.T) {
+	nominatim := testNominatim(newFakeNominatim(t, "").URL)
+
+	_, err := nominatim.Geocode("broken-city")
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "503") {
+		t.Errorf("broken-city: %v, want the 503", err)
+	}
+}
+
+// a self-hosted server under a path, given with a trailing slash
+func TestNominatimBaseURL(t *testing.T) {
+	fake := newFakeNominatim(t, "/nominatim")
+	nominatim := testNominatim(fake.URL + "/nominatim/")
+
+	if _, err := nominatim.Geocode("berlin-germany"); err != nil {
+		t.Fatal("berlin-germany:", err)
+	}
+	requests := fake.requestsFor("germany, berlin")
+	if len(requests) != 1 || requests[0].URL.Path != "/nominatim/search" {
+		t.Errorf("requests for berlin-germany: %v", requests)
+	}
+	if name := nominatim.Name(); name != "nominatim at "+fake.URL+"/nominatim" {
+		t.Errorf("name %q", name)
+	}
+}
+
+// gives the test an empty cache, queue and failure list and a downloader using provider.
+// The downloader is stopped and the package's state put back when the test ends
+func startTestDownloader(t *testing.T, testProvider Provider) {
+	oldCache, oldQueue, oldFailures := GeocodingCache, GeocodingQueue, failureCache
+	GeocodingCache, GeocodingQueue = makeGC(), makeGCQ(MaxQueueSize)
+	failureCache = &failureCacheT{failures: make(map[string]Failure)}
+	SetProvider(testProvider)
+	t.Cleanup(func() {
+		GeocodingCache, GeocodingQueue, failureCache = oldCache, oldQueue, oldFailures
+		SetProvider(NewNominatim(DefaultNominatimURL))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		GeocodeDownloader(ctx)
+		close(stopped)
+	}()
+	//cleanups run last in first out, so the downloader is gone before the state is put back
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+}
+
+// locations go through the queue and the downloader, the way handlers ask for them
+func TestDownloaderPipeline(t *testing.T) {
+	fake := newFakeNominatim(t, "")
+	startTestDownloader(t, testNominatim(fake.URL))
+
+	fetch := func(location string) (Marker, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return FetchCoordinates(ctx, location)
+	}
+
+	//a background location nobody waits on is downloaded too
+	QueueLocation("lima-peru", PriorityBackground)
+
+	marker, err := fetch("paris-france")
+	if err != nil {
+		t.Fatal("paris-france:", err)
+	}
+	if marker.Latitude == "" || marker.Source != "nominatim at "+fake.URL || marker.FetchedAt.IsZero() {
+		t.Errorf("paris-france: %+v", marker)
+	}
+	if cached, ok := CachedMarker("paris-france"); !ok || cached.Latitude != marker.Latitude {
+		t.Errorf("paris-france isn't cached: %+v", cached)
+	}
+
+	//asking again is answered from the cache
+	if _, err := fetch("paris-france"); err != nil {
+		t.Fatal("paris-france again:", err)
+	}
+	if _, err := fetch("lima-peru"); err != nil {
+		t.Fatal("lima-peru:", err)
+	}
+	for _, query := range []string{"france, paris", "peru, lima"} {
+		if requests := fake.requestsFor(query); len(requests) != 1 {
+			t.Errorf("%d requests for %q, want 1", len(requests), query)
+		}
+	}
+
+	//failures are remembered, asking again doesn't look the location up again until it's retried
+	for i := range 2 {
+		_, err := fetch("nowhere-atlantis")
+		var geocodeErr *GeocodeError
+		if !errors.As(err, &geocodeErr) || !errors.Is(err, ErrNotFound) || !geocodeErr.RetryAt.After(time.Now()) {
+			t.Errorf("nowhere-atlantis, try %d: %v", i+1, err)
+		}
+	}
+	if requests := fake.requestsFor("atlantis, nowhere"); len(requests) != 1 {
+		t.Errorf("%d requests for nowhere-atlantis, want 1", len(requests))
+	}
+
+	_, err = fetch("broken-city")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("broken-city: %v", err)
+	}
+	if _, ok := CachedMarker("broken-city"); ok {
+		t.Error("broken-city is cached")
+	}
+	//the provider can change while the downloader runs
+	SetProvider(Offline{})
+	marker, err = fetch("tokyo-japan")
+	if err != nil || marker.Source != (Offline{}).Name() {
+		t.Errorf("tokyo-japan after changing the provider: %+v, %v", marker, err)
+	}
+}
+
+func TestOffline(t *testing.T) {
+	first, err := Offline{}.Geocode("osaka-japan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := Offline{}.Geocode("osaka-japan")
+	other, _ := Offline{}.Geocode("berlin-germany")
+	if first != second || first == other {
+		t.Errorf("osaka-japan at %+v and %+v, berlin-germany at %+v", first, second, other)
+	}
+	if _, _, ok := first.Coordinates(); !ok {
+		t.Errorf("osaka-japan has no usable coordinates: %+v", first)
+	}
+	if first.Addresstype != "city" {
+		t.Errorf("address type %q", first.Addresstype)
+	}
+}
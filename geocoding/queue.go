@@ -0,0 +1,244 @@
+package geocoding
+
+import (
+	"context"
+	"errors"
+	"groupie/utils"
+	"slices"
+	"sync"
+	"time"
+)
+
+// how many locations can wait in the queue, past that background locations are turned away first
+const MaxQueueSize = 500
+
+// returned when a location can't be queued because the queue is full
+var ErrQueueFull = errors.New("geocoding queue is full")
+
+// how urgently a location is needed, higher priorities are downloaded first
+type Priority int
+
+const (
+	PriorityBackground Priority = iota // nobody waits on it, it's downloaded for later requests
+	PriorityWaiting                    // a request is waiting on it right now
+	priorityCount
+)
+
+// the outcome of a queued download, done is closed once marker or err is set
+type geocodeResult struct {
+	done   chan struct{}
+	marker Marker
+	err    error
+}
+
+// a location that's queued or being downloaded
+type queuedLocation struct {
+	result   *geocodeResult
+	priority Priority
+	inFlight bool
+}
+
+// numbers about the queue, for /admin/geocoding
+type QueueStats struct {
+	Depth        int `json:"depth"`        // locations waiting to be downloaded
+	Waiting      int `json:"waiting"`      // of those, the ones a request is waiting on
+	Background   int `json:"background"`   // of those, the ones nobody is waiting on
+	InFlight     int `json:"inFlight"`     // locations being downloaded right now
+	MaxSize      int `json:"maxSize"`      // most locations that can wait at once
+	Queued       int `json:"queued"`       // locations added since startup
+	Deduplicated int `json:"deduplicated"` // adds of a location that was already queued or in flight
+	Promoted     int `json:"promoted"`     // background locations moved up because a request started waiting on them
+	Dropped      int `json:"dropped"`      // locations turned away or pushed out because the queue was full
+	Completed    int `json:"completed"`    // locations that got a marker
+	Failed       int `json:"failed"`       // locations that didn't
+}
+
+// queue of locations that downloader will empty by downloading the coordinates, handlers add to this queue when their location wasn't found in the geocoding cache.
+// A location is only queued once, whoever adds it again waits on the same result. Locations a request waits on go ahead of background ones,
+// and when the queue is full background locations make room for them
+type GeocodingQueueT struct {
+	queues    [priorityCount][]string    //locations by priority, oldest first
+	locations map[string]*queuedLocation //queued and in-flight locations
+	maxSize   int
+	stats     QueueStats    //counters, the depths are filled in by Stats
+	wake      chan struct{} //signalled when something is added, so the downloader doesn't poll
+	mutex     sync.Mutex
+}
+
+func makeGCQ(maxSize int) *GeocodingQueueT {
+	return &GeocodingQueueT{
+		locations: make(map[string]*queuedLocation),
+		maxSize:   maxSize,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+var GeocodingQueue = makeGCQ(MaxQueueSize) //queue with geocoding requests that need to be loaded
+
+// number of locations waiting to be downloaded, the mutex must be held
+func (GCQ *GeocodingQueueT) depth() int {
+	depth := 0
+	for _, queue := range GCQ.queues {
+		depth += len(queue)
+	}
+	return depth
+}
+
+// queues the location unless it's already queued or being downloaded, and returns the result to wait on.
+// A queued location is moved up if it's added again with a higher priority. ErrQueueFull if there's no room for it
+func (GCQ *GeocodingQueueT) add(location string, priority Priority) (*geocodeResult, error) {
+	GCQ.mutex.Lock()
+	defer GCQ.mutex.Unlock()
+
+	if queued, ok := GCQ.locations[location]; ok {
+		GCQ.stats.Deduplicated++
+		if priority > queued.priority && !queued.inFlight {
+			GCQ.queues[queued.priority] = slices.DeleteFunc(GCQ.queues[queued.priority], func(other string) bool { return other == location })
+			GCQ.queues[priority] = append(GCQ.queues[priority], location)
+			queued.priority = priority
+			GCQ.stats.Promoted++
+		}
+		return queued.result, nil
+	}
+
+	if GCQ.depth() >= GCQ.maxSize && !GCQ.dropBackground(priority) {
+		GCQ.stats.Dropped++
+		return nil, ErrQueueFull
+	}
+
+	queued := &queuedLocation{result: &geocodeResult{done: make(chan struct{})}, priority: priority}
+	GCQ.locations[location] = queued
+	GCQ.queues[priority] = append(GCQ.queues[priority], location)
+	GCQ.stats.Queued++
+
+	select {
+	case GCQ.wake <- struct{}{}:
+	default: //the downloader has already been woken up
+	}
+	return queued.result, nil
+}
+
+// makes room for a location of the given priority by pushing out the newest location of a lower one,
+// false if there's nothing to push out. The mutex must be held
+func (GCQ *GeocodingQueueT) dropBackground(priority Priority) bool {
+	for lower := PriorityBackground; lower < priority; lower++ {
+		queue := GCQ.queues[lower]
+		if len(queue) == 0 {
+			continue
+		}
+		location := queue[len(queue)-1]
+		GCQ.queues[lower] = queue[:len(queue)-1]
+
+		dropped := GCQ.locations[location]
+		delete(GCQ.locations, location)
+		dropped.result.err = &GeocodeError{Location: location, Err: ErrQueueFull}
+		close(dropped.result.done)
+		GCQ.stats.Dropped++
+		return true
+	}
+	return false
+}
+
+// returns and removes the most urgent location of the queue, blocking until there is one.
+// False if ctx is done before that
+func (GCQ *GeocodingQueueT) next(ctx context.Context) (string, bool) {
+	for {
+		GCQ.mutex.Lock()
+		for priority := priorityCount - 1; priority >= PriorityBackground; priority-- {
+			queue := GCQ.queues[priority]
+			if len(queue) == 0 {
+				continue
+			}
+			location := queue[0]
+			GCQ.queues[priority] = queue[1:]
+			GCQ.locations[location].inFlight = true
+			GCQ.mutex.Unlock()
+			return location, true
+		}
+		GCQ.mutex.Unlock()
+
+		select {
+		case <-GCQ.wake:
+		case <-ctx.Done():
+			return "", false
+		}
+	}
+}
+
+// hands the outcome of a download to everyone waiting on it
+func (GCQ *GeocodingQueueT) resolve(location string, marker Marker, err error) {
+	GCQ.mutex.Lock()
+	queued, ok := GCQ.locations[location]
+	delete(GCQ.locations, location)
+	if err != nil {
+		GCQ.stats.Failed++
+	} else {
+		GCQ.stats.Completed++
+	}
+	GCQ.mutex.Unlock()
+
+	if ok {
+		queued.result.marker, queued.result.err = marker, err
+		close(queued.result.done)
+	}
+}
+
+// the queue's current depth and its counters since startup
+func (GCQ *GeocodingQueueT) Stats() QueueStats {
+	GCQ.mutex.Lock()
+	defer GCQ.mutex.Unlock()
+
+	stats := GCQ.stats
+	stats.Waiting = len(GCQ.queues[PriorityWaiting])
+	stats.Background = len(GCQ.queues[PriorityBackground])
+	stats.Depth = GCQ.depth()
+	stats.InFlight = len(GCQ.locations) - stats.Depth
+	stats.MaxSize = GCQ.maxSize
+	return stats
+}
+
+// number of markers in the cache
+func CachedCount() int {
+	return GeocodingCache.size()
+}
+
+// queues a location for download if it isn't in the cache yet and isn't cooling down after a failure, without waiting for it.
+// If the queue is full it's dropped, it'll be queued again the next time it's needed
+func QueueLocation(location string, priority Priority) {
+	if _, ok := GeocodingCache.get(location); ok {
+		return
+	}
+	if _, ok := failureCache.coolingDown(location, time.Now()); ok {
+		return
+	}
+	GeocodingQueue.add(location, priority)
+}
+
+// Returns a location's coordinates. If they're not in the cache the location is queued and this waits until the downloader is done with it,
+// or until ctx is done. A location that failed recently fails again right away until its cool-down is over. Errors are *GeocodeError
+func FetchCoordinates(ctx context.Context, location string) (Marker, error) {
+	marker, ok := CachedMarker(location)
+	if ok {
+		return marker, nil
+	}
+	if failure, ok := RecentFailure(location); ok {
+		return Marker{}, failure
+	}
+
+	// marker wasn't found in cache, so we're adding it to the queue to be downloaded
+	result, err := GeocodingQueue.add(location, PriorityWaiting)
+	if err != nil {
+		return Marker{}, &GeocodeError{Location: location, Err: err}
+	}
+	select {
+	case <-result.done:
+		if result.err != nil {
+			return Marker{}, result.err
+		}
+		marker = result.marker
+		marker.Location = utils.FixKey(location)
+		return marker, nil
+	case <-ctx.Done():
+		return Marker{}, &GeocodeError{Location: location, Err: ctx.Err()}
+	}
+}
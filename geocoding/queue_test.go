@@ -0,0 +1,189 @@
+package geocoding
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// takes the next location off the queue without waiting, "" if it's empty
+func takeNext(t *testing.T, queue *GeocodingQueueT) string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	//next only looks at ctx when there's nothing to hand out
+	location, ok := queue.next(ctx)
+	if !ok {
+		return ""
+	}
+	return location
+}
+
+func TestQueueDeduplicates(t *testing.T) {
+	queue := makeGCQ(5)
+
+	first, err := queue.add("osaka-japan", PriorityBackground)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := queue.add("osaka-japan", PriorityBackground)
+	if first != second {
+		t.Error("adding a location again gave another result to wait on")
+	}
+
+	//in flight it's still the same download
+	if location := takeNext(t, queue); location != "osaka-japan" {
+		t.Fatalf("next is %q", location)
+	}
+	third, _ := queue.add("osaka-japan", PriorityWaiting)
+	if third != first {
+		t.Error("adding a location in flight gave another result to wait on")
+	}
+
+	stats := queue.Stats()
+	if stats.Queued != 1 || stats.Deduplicated != 2 || stats.Promoted != 0 || stats.Depth != 0 || stats.InFlight != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+
+	//once it's done it can be queued again
+	queue.resolve("osaka-japan", Marker{Latitude: "1", Longitude: "2"}, nil)
+	<-first.done
+	if first.marker.Latitude != "1" || first.err != nil {
+		t.Errorf("result %+v", first)
+	}
+	if again, _ := queue.add("osaka-japan", PriorityBackground); again == first {
+		t.Error("a finished location wasn't queued again")
+	}
+}
+
+func TestQueuePromotes(t *testing.T) {
+	queue := makeGCQ(5)
+	for _, location := range []string{"a-x", "b-x", "c-x"} {
+		queue.add(location, PriorityBackground)
+	}
+	queue.add("w-x", PriorityWaiting)
+
+	//someone starts waiting on a background location, it moves up behind the ones already waited on
+	queue.add("b-x", PriorityWaiting)
+	//asking with a lower priority doesn't move anything down
+	queue.add("w-x", PriorityBackground)
+
+	stats := queue.Stats()
+	if stats.Promoted != 1 || stats.Waiting != 2 || stats.Background != 2 || stats.Depth != 4 {
+		t.Errorf("stats %+v", stats)
+	}
+
+	order := []string{}
+	for location := takeNext(t, queue); location != ""; location = takeNext(t, queue) {
+		order = append(order, location)
+	}
+	want := []string{"w-x", "b-x", "a-x", "c-x"}
+	if len(order) != len(want) {
+		t.Fatalf("order %q, want %q", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order %q, want %q", order, want)
+		}
+	}
+}
+
+func TestQueueSizeBound(t *testing.T) {
+	queue := makeGCQ(2)
+
+	oldest, _ := queue.add("a-x", PriorityBackground)
+	newest, _ := queue.add("b-x", PriorityBackground)
+
+	//full, a background location is turned away
+	if _, err := queue.add("c-x", PriorityBackground); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("background location in a full queue: %v", err)
+	}
+
+	//a waited on location pushes out the newest background one, whoever waited on that one is told
+	if _, err := queue.add("w-x", PriorityWaiting); err != nil {
+		t.Fatal("waited on location in a full queue:", err)
+	}
+	select {
+	case <-newest.done:
+		if !errors.Is(newest.err, ErrQueueFull) {
+			t.Errorf("pushed out location: %v", newest.err)
+		}
+	default:
+		t.Error("the pushed out location is still waited on")
+	}
+	select {
+	case <-oldest.done:
+		t.Error("the oldest background location was pushed out")
+	default:
+	}
+
+	queue.add("v-x", PriorityWaiting)
+	//nothing left to push out
+	if _, err := queue.add("u-x", PriorityWaiting); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("waited on location with only waited on ones queued: %v", err)
+	}
+
+	stats := queue.Stats()
+	if stats.Depth != 2 || stats.Waiting != 2 || stats.Background != 0 || stats.Dropped != 4 || stats.Queued != 4 || stats.MaxSize != 2 {
+		t.Errorf("stats %+v", stats)
+	}
+
+	//locations in flight don't take up room
+	takeNext(t, queue)
+	if _, err := queue.add("u-x", PriorityWaiting); err != nil {
+		t.Errorf("after taking one off the queue: %v", err)
+	}
+}
+
+func TestDropBackground(t *testing.T) {
+	queue := makeGCQ(5)
+	if queue.dropBackground(PriorityWaiting) {
+		t.Error("dropped from an empty queue")
+	}
+
+	queue.add("w-x", PriorityWaiting)
+	if queue.dropBackground(PriorityWaiting) || queue.dropBackground(PriorityBackground) {
+		t.Error("dropped a location that isn't of a lower priority")
+	}
+
+	queue.add("a-x", PriorityBackground)
+	queue.add("b-x", PriorityBackground)
+	if !queue.dropBackground(PriorityWaiting) {
+		t.Fatal("nothing dropped")
+	}
+	if _, ok := queue.locations["b-x"]; ok {
+		t.Error("the newest background location is still queued")
+	}
+	if _, ok := queue.locations["a-x"]; !ok {
+		t.Error("the oldest background location was dropped")
+	}
+	if stats := queue.Stats(); stats.Dropped != 1 || stats.Background != 1 || stats.Waiting != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestQueueStats(t *testing.T) {
+	queue := makeGCQ(5)
+	for _, location := range []string{"a-x", "b-x", "c-x"} {
+		queue.add(location, PriorityBackground)
+	}
+
+	takeNext(t, queue)
+	takeNext(t, queue)
+	queue.resolve("a-x", Marker{}, nil)
+	queue.resolve("b-x", Marker{}, ErrNotFound)
+
+	stats := queue.Stats()
+	want := QueueStats{Depth: 1, Background: 1, MaxSize: 5, Queued: 3, Completed: 1, Failed: 1}
+	if stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+
+	takeNext(t, queue)
+	if stats := queue.Stats(); stats.InFlight != 1 || stats.Depth != 0 {
+		t.Errorf("stats with one in flight %+v", stats)
+	}
+	if location := takeNext(t, queue); location != "" {
+		t.Errorf("took %q off an empty queue", location)
+	}
+}
@@ -1,3 +1,5 @@
 module groupie
 
 go 1.22.2
+
+require golang.org/x/text v0.21.0
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+)
+
+// who can see the admin pages
+const (
+	AdminLocal  = "local"  // only requests from the machine the server runs on
+	AdminPublic = "public" // everyone
+	AdminOff    = "off"    // nobody
+)
+
+// set from GROUPIE_ADMIN before the server starts
+var AdminAccess = AdminLocal
+
+// checks an admin access setting
+func ParseAdminAccess(value string) (string, error) {
+	switch value {
+	case AdminLocal, AdminPublic, AdminOff:
+		return value, nil
+	}
+	return "", fmt.Errorf(`must be "local", "public" or "off", got %q`, value)
+}
+
+// wraps an admin page so it's only served as AdminAccess allows, everyone else gets a 404 as if it didn't exist
+func AdminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		allowed := AdminAccess == AdminPublic || AdminAccess == AdminLocal && isLocalRequest(request)
+		if !allowed {
+			SendErrorPage(writer, 404, "404 - Page not found")
+			return
+		}
+		next(writer, request)
+	}
+}
+
+// true if the request comes from the loopback interface. Requests passed on by a proxy don't count,
+// the proxy may run on the same machine but the user behind it doesn't
+func isLocalRequest(request *http.Request) bool {
+	if request.Header.Get("Forwarded") != "" || request.Header.Get("X-Forwarded-For") != "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// admin page listing the records that were left out of the dataset
+func RejectedHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != "/admin/rejected" {
+		SendErrorPage(writer, 404, "404 - Page not found")
+		return
+	}
+
+	data := Data()
+
+	//html/template, since the rejected values are exactly the kind of data we can't trust
+	tmpl, err := template.ParseFiles("../templates/rejected.html")
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		SendErrorPage(writer, 500, "500 - Internal Server Error")
+		return
+	}
+
+	pageData := struct {
+		Rejected []RejectedRecord
+		DataAge  string
+	}{
+		Rejected: data.Rejected,
+		DataAge:  data.AgeText(),
+	}
+
+	if err := tmpl.Execute(writer, pageData); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminOnly(t *testing.T) {
+	defer func(access string) { AdminAccess = access }(AdminAccess)
+
+	handler := AdminOnly(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		access     string
+		remoteAddr string
+		forwarded  bool
+		status     int
+	}{
+		{AdminLocal, "127.0.0.1:51000", false, 200},
+		{AdminLocal, "[::1]:51000", false, 200},
+		{AdminLocal, "192.168.1.20:51000", false, 404},
+		{AdminLocal, "127.0.0.1:51000", true, 404},
+		{AdminPublic, "192.168.1.20:51000", false, 200},
+		{AdminOff, "127.0.0.1:51000", false, 404},
+	}
+	for _, test := range tests {
+		AdminAccess = test.access
+		request := httptest.NewRequest("GET", "/admin/rejected", nil)
+		request.RemoteAddr = test.remoteAddr
+		if test.forwarded {
+			request.Header.Set("X-Forwarded-For", "203.0.113.7")
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		if recorder.Code != test.status {
+			t.Errorf("%s access, %s (forwarded %v): status %d, want %d", test.access, test.remoteAddr, test.forwarded, recorder.Code, test.status)
+		}
+	}
+}
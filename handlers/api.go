@@ -1,7 +1,11 @@
 package api
 
 import (
-	"groupie/utils"
+	"fmt"
+	"groupie/geocoding"
+	"slices"
+	"strings"
+	"time"
 )
 
 // holds relational information for artists
@@ -14,6 +18,27 @@ type relationResponse struct {
 	Relations []Relation `json:"index"`
 }
 
+// holds the concert locations of an artist
+type Location struct {
+	ID        int      `json:"id"`
+	Locations []string `json:"locations"`
+	DatesURL  string   `json:"dates"`
+}
+
+type locationResponse struct {
+	Locations []Location `json:"index"`
+}
+
+// holds the concert dates of an artist, a date starting with "*" is the first date of the next location
+type Date struct {
+	ID    int      `json:"id"`
+	Dates []string `json:"dates"`
+}
+
+type dateResponse struct {
+	Dates []Date `json:"index"`
+}
+
 // Holds artist information
 type Artist struct {
 	ID           int      `json:"id"`
@@ -22,15 +47,9 @@ type Artist struct {
 	Members      []string `json:"members"`
 	CreationDate int      `json:"creationDate"`
 	FirstAlbum   string   `json:"firstAlbum"`
-}
 
-// global variables to be loaded once when the server starts
-var (
-	Artists           []Artist
-	RelationData      []Relation
-	ArtistRelationMap = make(map[int]Relation)
-	ArtistMap         = make(map[int]Artist)
-)
+	FirstAlbumDate time.Time `json:"-"` // parsed FirstAlbum, set by validation
+}
 
 // filters that come from the front and are used to filter results
 type FilterT struct {
@@ -40,65 +59,163 @@ type FilterT struct {
 	CreationYearEnd          int
 	FirstAlbumYearStart      int
 	FirstAlbumYearEnd        int
-	ConcertFilter            string
+	ConcertFilters           []string // locations as displayed to the user, "Osaka - Japan"
+	CountryFilters           []string // countries as displayed to the user, "Japan"
+	ContinentFilters         []string // "Europe"
+	LocationMatch            string   // "any" if a concert in one of the selected places is enough, "all" if every one needs a concert
+	ConcertDateStart         string   // YYYY-MM-DD as it came in, "" for no limit
+	ConcertDateEnd           string
+	Near                     string  // centre of the radius filter, a location ("berlin-germany") or coordinates ("52.52,13.40"), "" for no radius filter
+	RadiusKm                 float64 // how far from Near concerts can be
 	SearchBar                string
+	Sort                     string // one of the sortOptions, "" to keep the relevance (or upstream) order
+	Order                    string // "asc" or "desc"
+
+	concertStart, concertEnd time.Time // parsed ConcertDateStart and ConcertDateEnd, zero for no limit
+	nearLatitude             float64   // coordinates of Near, if nearKnown
+	nearLongitude            float64
+	nearLocation             string                  // location key of Near, "" if it's coordinates
+	nearKnown                bool                    // false if Near is a location that isn't geocoded yet
+	nearFailure              *geocoding.GeocodeError // why Near couldn't be geocoded, if it's cooling down after a failure
 }
 
-// makes API call to download the artists and their relation data
-func LoadArtistData() ([]Artist, []Relation, error) {
-	var artists []Artist
-	var relationData relationResponse
+// true if the radius filter is set
+func (filter FilterT) hasRadius() bool {
+	return filter.Near != ""
+}
 
-	artistChan := make(chan []Artist)
-	artistErrChan := make(chan error)
-	go func() {
-		// Fetch artist data
-		res, err := utils.LoadDataFromURL("https://groupietrackers.herokuapp.com/api/artists", &artists, 20)
-		artistChan <- *res
-		artistErrChan <- err
-	}()
+// true if the concert has a geocoded location inside the radius.
+// The markers are taken from the geocoding cache, so locations geocoded after the dataset was built count too
+func (filter FilterT) inRadius(concert Concert) bool {
+	if !filter.nearKnown {
+		return false
+	}
+	marker, ok := concert.Marker()
+	if !ok {
+		return false
+	}
+	latitude, longitude, ok := marker.Coordinates()
+	return ok && geocoding.DistanceKm(filter.nearLatitude, filter.nearLongitude, latitude, longitude) <= filter.RadiusKm
+}
 
-	relationChan := make(chan relationResponse)
-	relationErrChan := make(chan error)
-	go func() {
-		// Fetch relations data
-		res, err := utils.LoadDataFromURL("https://groupietrackers.herokuapp.com/api/relation", &relationData, 20)
-		relationChan <- *res
-		relationErrChan <- err
-	}()
+// returns a concert of every location in the date window that isn't geocoded, so the radius filter can't check it
+func (filter FilterT) ungeocodedConcerts(data *Dataset) []Concert {
+	concerts := []Concert{}
+	seen := map[string]bool{}
+	for _, concert := range filter.concertsInWindow(data.Concerts.ByDate) {
+		if seen[concert.Location] {
+			continue
+		}
+		seen[concert.Location] = true
+
+		marker, ok := concert.Marker()
+		if _, _, valid := marker.Coordinates(); !ok || !valid {
+			concerts = append(concerts, concert)
+		}
+	}
+	return concerts
+}
 
-	artists, relations, err := consumeChannels(artistChan, relationChan, artistErrChan, relationErrChan)
+// explains what the radius filter couldn't check: a centre that isn't geocoded (yet), or concert locations that aren't
+func (filter FilterT) radiusNotes(data *Dataset) []string {
+	if !filter.hasRadius() {
+		return nil
+	}
+	if filter.nearFailure != nil {
+		return []string{fmt.Sprintf("%s couldn't be geocoded (%s), so no concerts could be checked against it. It's looked up again after %s",
+			filter.Near, unresolvedReason(filter.nearFailure), filter.nearFailure.RetryAt.UTC().Format("2006-01-02 15:04 MST"))}
+	}
+	if !filter.nearKnown {
+		return []string{fmt.Sprintf("%s isn't geocoded yet, so no concerts could be checked against it. It's been queued for download, try again in a moment", filter.Near)}
+	}
 
-	return artists, relations, err
+	skipped := []string{}
+	for _, concert := range filter.ungeocodedConcerts(data) {
+		skipped = append(skipped, concert.Label())
+	}
+	if len(skipped) == 0 {
+		return nil
+	}
+	slices.Sort(skipped)
+	return []string{fmt.Sprintf("%d concert locations aren't geocoded yet and were skipped by the radius filter: %s", len(skipped), strings.Join(skipped, ", "))}
 }
 
-func consumeChannels(artistChan chan []Artist, relationChan chan relationResponse, artistErrChan, relationErrChan chan error) ([]Artist, []Relation, error) {
+// true if the concert date window is set
+func (filter FilterT) hasConcertWindow() bool {
+	return !filter.concertStart.IsZero() || !filter.concertEnd.IsZero()
+}
 
-	var artists []Artist
-	var relations []Relation
-	for range 4 {
-		select {
-		case artistsResp := <-artistChan:
-			for _, artist := range artistsResp {
-				ArtistMap[artist.ID] = artist
-			}
-			artists = artistsResp
-		case relationResp := <-relationChan:
-			for _, relation := range relationResp.Relations {
-				ArtistRelationMap[relation.ID] = relation
-			}
-			relations = relationResp.Relations
+// true if any location, country or continent is selected
+func (filter FilterT) hasLocationFilter() bool {
+	return len(filter.ConcertFilters) > 0 || len(filter.CountryFilters) > 0 || len(filter.ContinentFilters) > 0
+}
 
-		case errResp := <-artistErrChan:
-			if errResp != nil {
-				return nil, nil, errResp
+// checks the concerts against the selected locations, countries and continents, with any or all semantics
+func (filter FilterT) matchesLocations(concerts []Concert) bool {
+	matched := func(selected []string, value func(Concert) string) []bool {
+		found := make([]bool, len(selected))
+		for _, concert := range concerts {
+			for i, place := range selected {
+				if value(concert) == place {
+					found[i] = true
+				}
 			}
+		}
+		return found
+	}
+
+	found := slices.Concat(
+		matched(filter.ConcertFilters, Concert.Label),
+		matched(filter.CountryFilters, func(concert Concert) string { return concert.Country }),
+		matched(filter.ContinentFilters, Concert.Continent),
+	)
+
+	if filter.LocationMatch == "all" {
+		return !slices.Contains(found, false)
+	}
+	return slices.Contains(found, true)
+}
+
+// returns the concerts inside the concert date window, all of them if it isn't set. concerts must be ordered by date
+func (filter FilterT) concertsInWindow(concerts []Concert) []Concert {
+	if !filter.hasConcertWindow() {
+		return concerts
+	}
+	return concertsBetween(concerts, filter.concertStart, filter.concertEnd)
+}
+
+// loads the artists and their relation data from the given source. Data from a remote source is saved into the snapshot file,
+// and if the remote source can't be reached the snapshot is used instead
+func LoadArtistData(source DataSource) (*Dataset, error) {
+
+	remote := source.Remote()
+
+	//if we have a snapshot to fall back to, don't make the user wait for all the retries
+	if remote && snapshotExists() {
+		source = withFewerRetries(source, 3)
+	}
 
-		case errResp := <-relationErrChan:
-			if errResp != nil {
-				return nil, nil, errResp
+	sourceData, err := source.Load()
+	if err == nil {
+		data := NewDataset(sourceData, time.Now(), false)
+		if remote {
+			if err := SaveSnapshot(sourceData, data.FetchedAt); err != nil {
+				fmt.Println("ERROR: failed to save snapshot:", err)
 			}
 		}
+		return data, nil
 	}
-	return artists, relations, nil
+
+	if !remote {
+		return nil, fmt.Errorf("failed to load artist data from %s: %v", source.Name(), err)
+	}
+
+	fmt.Println("ERROR: failed to fetch artist data, trying snapshot:", err)
+
+	snapshot, snapErr := LoadSnapshot()
+	if snapErr != nil {
+		return nil, fmt.Errorf("%v, and no usable snapshot: %v", err, snapErr)
+	}
+
+	return NewDataset(snapshot.sourceData(), snapshot.FetchedAt, true), nil
 }
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"groupie/geocoding"
+	"groupie/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+// a single concert of an artist, built once when the dataset is built
+type Concert struct {
+	ArtistID int
+	City     string // as displayed to the user, "Los Angeles"
+	Country  string // as displayed to the user, "USA"
+	Date     time.Time
+	Location string // location key as it comes from the data source, "los_angeles-usa". Its coordinates are in the geocoding cache
+}
+
+// location as displayed to the user, "Los Angeles - USA"
+func (concert Concert) Label() string {
+	return concert.City + " - " + concert.Country
+}
+
+// country part of the location key, "usa"
+func (concert Concert) CountryKey() string {
+	return concert.Location[strings.LastIndex(concert.Location, "-")+1:]
+}
+
+// continent of the concert's country, "" if it isn't in the continent table
+func (concert Concert) Continent() string {
+	return continentOf(concert.CountryKey())
+}
+
+// marker of the concert's location from the geocoding cache as it is now, false if it isn't geocoded yet.
+// Locations geocoded after the dataset was built have one too
+func (concert Concert) Marker() (geocoding.Marker, bool) {
+	return geocoding.CachedMarker(concert.Location)
+}
+
+// concerts of one location, with their dates as displayed to the user
+type ConcertGroup struct {
+	Location string
+	Dates    []string
+}
+
+// all the concerts of a dataset, with lookups by artist, by location, by country and by date
+type ConcertIndex struct {
+	ByDate     []Concert            // every concert, ordered by date
+	ByArtist   map[int][]Concert    // ordered by date
+	ByLocation map[string][]Concert // by location key, ordered by date
+	ByCountry  map[string][]Concert // by country as displayed to the user, ordered by date
+	Locations  []string             // every location as displayed to the user, ordered by country and then city
+}
+
+// builds the concerts out of the relation data, the relation data is expected to be validated already
+func newConcertIndex(relations []Relation) ConcertIndex {
+	index := ConcertIndex{
+		ByArtist:   map[int][]Concert{},
+		ByLocation: map[string][]Concert{},
+		ByCountry:  map[string][]Concert{},
+	}
+
+	locations := map[string]Concert{}
+	for _, relation := range relations {
+		for location, dates := range relation.DatesLocations {
+			city, country, _ := strings.Cut(utils.FixKey(location), " - ")
+
+			for _, rawDate := range dates {
+				date, err := time.Parse(dateLayout, rawDate)
+				if err != nil {
+					continue
+				}
+				concert := Concert{
+					ArtistID: relation.ID,
+					City:     city,
+					Country:  country,
+					Date:     date,
+					Location: location,
+				}
+				index.ByDate = append(index.ByDate, concert)
+				locations[concert.Label()] = concert
+			}
+		}
+	}
+
+	sortConcerts(index.ByDate)
+	for _, concert := range index.ByDate {
+		index.ByArtist[concert.ArtistID] = append(index.ByArtist[concert.ArtistID], concert)
+		index.ByLocation[concert.Location] = append(index.ByLocation[concert.Location], concert)
+		index.ByCountry[concert.Country] = append(index.ByCountry[concert.Country], concert)
+	}
+
+	for label := range locations {
+		index.Locations = append(index.Locations, label)
+	}
+	sort.Slice(index.Locations, func(i, j int) bool {
+		iConcert, jConcert := locations[index.Locations[i]], locations[index.Locations[j]]
+		if iConcert.Country == jConcert.Country {
+			return iConcert.City < jConcert.City
+		}
+		return iConcert.Country < jConcert.Country
+	})
+
+	return index
+}
+
+// orders concerts by date, concerts on the same day by location
+func sortConcerts(concerts []Concert) {
+	sort.SliceStable(concerts, func(i, j int) bool {
+		if concerts[i].Date.Equal(concerts[j].Date) {
+			return concerts[i].Location < concerts[j].Location
+		}
+		return concerts[i].Date.Before(concerts[j].Date)
+	})
+}
+
+// returns the concerts from start to end, both days included, a zero start or end is no limit.
+// concerts must be ordered by date, like all the slices of a ConcertIndex are
+func concertsBetween(concerts []Concert, start, end time.Time) []Concert {
+	from, to := 0, len(concerts)
+	if !start.IsZero() {
+		from = sort.Search(len(concerts), func(i int) bool { return !concerts[i].Date.Before(start) })
+	}
+	if !end.IsZero() {
+		to = sort.Search(len(concerts), func(i int) bool { return concerts[i].Date.After(end) })
+	}
+	if from >= to {
+		return nil
+	}
+	return concerts[from:to]
+}
+
+// groups concerts by location, ordered by country and city, with the dates of each location in order
+func groupConcerts(concerts []Concert) []ConcertGroup {
+	groups := []ConcertGroup{}
+	groupIndex := map[string]int{}
+
+	ordered := make([]Concert, len(concerts))
+	copy(ordered, concerts)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Country != ordered[j].Country {
+			return ordered[i].Country < ordered[j].Country
+		}
+		if ordered[i].City != ordered[j].City {
+			return ordered[i].City < ordered[j].City
+		}
+		return ordered[i].Date.Before(ordered[j].Date)
+	})
+
+	for _, concert := range ordered {
+		label := concert.Label()
+		i, ok := groupIndex[label]
+		if !ok {
+			i = len(groups)
+			groupIndex[label] = i
+			groups = append(groups, ConcertGroup{Location: label})
+		}
+		groups[i].Dates = append(groups[i].Dates, concert.Date.Format("02/01/2006"))
+	}
+	return groups
+}
+
+// returns the location keys of the concerts, each once, in the order they first appear
+func concertLocations(concerts []Concert) []string {
+	locations := []string{}
+	seen := map[string]bool{}
+	for _, concert := range concerts {
+		if !seen[concert.Location] {
+			seen[concert.Location] = true
+			locations = append(locations, concert.Location)
+		}
+	}
+	return locations
+}
@@ -0,0 +1,55 @@
+package api
+
+import "strings"
+
+// countries by continent, written the way location keys write them ("new_zealand", "usa").
+// Countries that aren't here can still be filtered by, just not through a continent
+var continentCountries = map[string][]string{
+	"Africa": {
+		"algeria", "angola", "botswana", "cameroon", "egypt", "ethiopia", "ghana", "ivory_coast", "kenya", "madagascar",
+		"mauritius", "morocco", "mozambique", "namibia", "nigeria", "reunion", "rwanda", "senegal", "south_africa",
+		"tanzania", "tunisia", "uganda", "zambia", "zimbabwe",
+	},
+	"Asia": {
+		"bahrain", "bangladesh", "cambodia", "china", "hong_kong", "india", "indonesia", "iran", "iraq", "israel",
+		"japan", "jordan", "kazakhstan", "korea", "kuwait", "lebanon", "macau", "malaysia", "mongolia", "nepal",
+		"oman", "pakistan", "philippine", "philippines", "qatar", "saudi_arabia", "singapore", "south_korea",
+		"sri_lanka", "taiwan", "thailand", "turkey", "uae", "united_arab_emirates", "vietnam",
+	},
+	"Europe": {
+		"albania", "andorra", "austria", "belarus", "belgium", "bosnia_and_herzegovina", "bulgaria", "croatia",
+		"cyprus", "czech_republic", "czechia", "denmark", "england", "estonia", "finland", "france", "georgia",
+		"germany", "greece", "hungary", "iceland", "ireland", "italy", "latvia", "lithuania", "luxembourg", "malta",
+		"moldova", "monaco", "montenegro", "netherlands", "north_macedonia", "northern_ireland", "norway", "poland",
+		"portugal", "romania", "russia", "scotland", "serbia", "slovakia", "slovenia", "spain", "sweden",
+		"switzerland", "uk", "ukraine", "united_kingdom", "wales",
+	},
+	"North America": {
+		"bahamas", "barbados", "canada", "costa_rica", "cuba", "dominican_republic", "el_salvador", "guatemala",
+		"honduras", "jamaica", "mexico", "netherlands_antilles", "nicaragua", "panama", "puerto_rico",
+		"trinidad_and_tobago", "united_states", "usa",
+	},
+	"South America": {
+		"argentina", "bolivia", "brazil", "chile", "colombia", "ecuador", "paraguay", "peru", "uruguay", "venezuela",
+	},
+	"Oceania": {
+		"australia", "fiji", "french_polynesia", "guam", "new_caledonia", "new_zealand", "papua_new_guinea",
+	},
+}
+
+var countryContinents = makeCountryContinents()
+
+func makeCountryContinents() map[string]string {
+	continents := map[string]string{}
+	for continent, countries := range continentCountries {
+		for _, country := range countries {
+			continents[country] = continent
+		}
+	}
+	return continents
+}
+
+// continent of a country as location keys write it, "" if it isn't in the table
+func continentOf(countryKey string) string {
+	return countryContinents[strings.ToLower(countryKey)]
+}
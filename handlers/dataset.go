@@ -0,0 +1,185 @@
+package api
+
+import (
+	"fmt"
+	"groupie/utils"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// all the artist data the handlers work with. A dataset is never modified after it's built,
+// a refresh builds a new one and swaps it in as a whole, so a request never sees half updated data
+type Dataset struct {
+	Artists           []Artist
+	Relations         []Relation
+	Locations         []Location
+	Dates             []Date
+	ArtistMap         map[int]Artist
+	ArtistRelationMap map[int]Relation
+	LocationMap       map[int]Location
+	DateMap           map[int]Date
+	Concerts          ConcertIndex
+	Search            *SearchIndex
+
+	//problems found when cross-checking the relation, locations and dates data
+	Quality QualityReport
+	//records left out because they didn't pass validation
+	Rejected []RejectedRecord
+
+	FetchedAt    time.Time
+	FromSnapshot bool
+}
+
+// the dataset currently being served
+var currentData atomic.Pointer[Dataset]
+
+// returns the dataset currently being served, handlers should call it once per request and keep using the same pointer
+func Data() *Dataset {
+	data := currentData.Load()
+	if data == nil {
+		return &Dataset{Search: &SearchIndex{}}
+	}
+	return data
+}
+
+// replaces the dataset being served
+func SetData(data *Dataset) {
+	currentData.Store(data)
+}
+
+// validates the loaded data and builds a dataset, its lookup maps and its data quality report
+func NewDataset(loaded SourceData, fetchedAt time.Time, fromSnapshot bool) *Dataset {
+	sourceData, rejected := validateSourceData(loaded)
+
+	data := &Dataset{
+		Artists:           sourceData.Artists,
+		Relations:         sourceData.Relations,
+		Locations:         sourceData.Locations,
+		Dates:             sourceData.Dates,
+		ArtistMap:         make(map[int]Artist, len(sourceData.Artists)),
+		ArtistRelationMap: make(map[int]Relation, len(sourceData.Relations)),
+		LocationMap:       make(map[int]Location, len(sourceData.Locations)),
+		DateMap:           make(map[int]Date, len(sourceData.Dates)),
+		FetchedAt:         fetchedAt,
+		FromSnapshot:      fromSnapshot,
+		Rejected:          rejected,
+	}
+	for _, artist := range data.Artists {
+		data.ArtistMap[artist.ID] = artist
+	}
+	for _, relation := range data.Relations {
+		data.ArtistRelationMap[relation.ID] = relation
+	}
+	for _, location := range data.Locations {
+		data.LocationMap[location.ID] = location
+	}
+	for _, date := range data.Dates {
+		data.DateMap[date.ID] = date
+	}
+
+	data.Concerts = newConcertIndex(data.Relations)
+	data.Search = newSearchIndex(data)
+	data.Quality = checkDataQuality(data, loaded)
+
+	return data
+}
+
+// text shown on the page about how old the served data is
+func (data *Dataset) AgeText() string {
+	if data.FetchedAt.IsZero() {
+		return ""
+	}
+	age := utils.HumanDuration(time.Since(data.FetchedAt))
+	if data.FromSnapshot {
+		return fmt.Sprintf("Offline snapshot, data is %s old", age)
+	}
+	return fmt.Sprintf("Live data, fetched %s ago", age)
+}
+
+// what changed between two datasets, by artist ID
+type datasetDiff struct {
+	Added   []int
+	Removed []int
+	Changed []int
+}
+
+func (diff datasetDiff) empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+// compares the artists and their relations of two datasets
+func diffDatasets(oldData, newData *Dataset) datasetDiff {
+	diff := datasetDiff{}
+
+	for id, newArtist := range newData.ArtistMap {
+		oldArtist, ok := oldData.ArtistMap[id]
+		if !ok {
+			diff.Added = append(diff.Added, id)
+			continue
+		}
+		if !reflect.DeepEqual(oldArtist, newArtist) || !reflect.DeepEqual(oldData.ArtistRelationMap[id], newData.ArtistRelationMap[id]) {
+			diff.Changed = append(diff.Changed, id)
+		}
+	}
+
+	for id := range oldData.ArtistMap {
+		if _, ok := newData.ArtistMap[id]; !ok {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+
+	sort.Ints(diff.Added)
+	sort.Ints(diff.Removed)
+	sort.Ints(diff.Changed)
+	return diff
+}
+
+// Re-downloads the artist data at an interval and swaps it in, keeps serving the old data if the download fails
+func DataRefresher(source DataSource, interval time.Duration) {
+	//no need to keep retrying for long, there will be another refresh soon
+	source = withFewerRetries(source, 3)
+
+	for {
+		time.Sleep(interval)
+
+		diff, err := refreshData(source)
+		if err != nil {
+			fmt.Println("ERROR: refreshing artist data failed, keeping old data:", err)
+			continue
+		}
+
+		if diff.empty() {
+			fmt.Println("Artist data refreshed, nothing changed")
+		} else {
+			fmt.Printf("Artist data refreshed, added: %v, removed: %v, changed: %v\n", diff.Added, diff.Removed, diff.Changed)
+		}
+	}
+}
+
+// loads the artist data again and swaps it in, returns what changed. The served data stays as it is if loading fails
+func refreshData(source DataSource) (datasetDiff, error) {
+	sourceData, err := source.Load()
+	if err != nil {
+		return datasetDiff{}, err
+	}
+
+	newData := NewDataset(sourceData, time.Now(), false)
+	diff := diffDatasets(Data(), newData)
+	SetData(newData)
+
+	if len(newData.Rejected) > 0 {
+		fmt.Printf("WARNING: %d records rejected, see /admin/rejected\n", len(newData.Rejected))
+	}
+	if len(newData.Quality.Issues) > 0 {
+		fmt.Printf("WARNING: %d data quality issues, see /data-quality\n", len(newData.Quality.Issues))
+	}
+
+	if source.Remote() {
+		if err := SaveSnapshot(sourceData, newData.FetchedAt); err != nil {
+			fmt.Println("ERROR: failed to save snapshot:", err)
+		}
+	}
+	return diff, nil
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// a source that can't be reached
+type failingSource struct{}
+
+func (failingSource) Load() (SourceData, error) {
+	return SourceData{}, errors.New("unreachable")
+}
+
+func (failingSource) Name() string {
+	return "failing source"
+}
+
+func (failingSource) Remote() bool {
+	return false
+}
+
+// the test fixture a refresh later: Queen played another concert, Motörhead is gone and Björk is new
+func changedFixture() FixtureSource {
+	source := testFixture()
+	source.Artists = slices.Delete(source.Artists, 1, 2)
+	source.Relations = slices.Delete(source.Relations, 1, 2)
+	source.Relations[0].DatesLocations = map[string][]string{"osaka-japan": {"28-01-2020"}, "london-uk": {"10-11-2019", "11-11-2019"}}
+	source.Artists = append(source.Artists, Artist{ID: 4, Name: "Björk", Members: []string{"Björk Guðmundsdóttir"}, CreationDate: 1977, FirstAlbum: "01-07-1977"})
+	source.Relations = append(source.Relations, Relation{ID: 4, DatesLocations: map[string][]string{"reykjavik-iceland": {"01-06-2019"}}})
+	return source
+}
+
+func TestDiffDatasets(t *testing.T) {
+	dataset := func(source FixtureSource) *Dataset {
+		data, err := LoadArtistData(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	renamed := testFixture()
+	renamed.Artists[2].Name = "Sigur Ros"
+
+	tests := []struct {
+		name     string
+		old, new FixtureSource
+		want     datasetDiff
+	}{
+		{"nothing changed", testFixture(), testFixture(), datasetDiff{}},
+		{"added, removed and changed", testFixture(), changedFixture(), datasetDiff{Added: []int{4}, Removed: []int{2}, Changed: []int{1}}},
+		{"artist changed", testFixture(), renamed, datasetDiff{Changed: []int{3}}},
+		{"from nothing", FixtureSource{}, testFixture(), datasetDiff{Added: []int{1, 2, 3}}},
+	}
+
+	for _, test := range tests {
+		diff := diffDatasets(dataset(test.old), dataset(test.new))
+		if !slices.Equal(diff.Added, test.want.Added) || !slices.Equal(diff.Removed, test.want.Removed) || !slices.Equal(diff.Changed, test.want.Changed) {
+			t.Errorf("%s: %+v, want %+v", test.name, diff, test.want)
+		}
+		if diff.empty() != (len(test.want.Added)+len(test.want.Removed)+len(test.want.Changed) == 0) {
+			t.Errorf("%s: empty is %v", test.name, diff.empty())
+		}
+	}
+}
+
+// a refresh swaps the new data in as a whole, a failed one keeps serving the old data
+func TestRefreshData(t *testing.T) {
+	old := useFixture(t, testFixture())
+	mux := apiMux()
+
+	if _, err := refreshData(failingSource{}); err == nil {
+		t.Error("refreshed from a failing source")
+	}
+	if Data() != old {
+		t.Error("a failed refresh replaced the data")
+	}
+
+	before := time.Now()
+	diff, err := refreshData(changedFixture())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(diff.Added, []int{4}) || !slices.Equal(diff.Removed, []int{2}) || !slices.Equal(diff.Changed, []int{1}) {
+		t.Errorf("diff %+v", diff)
+	}
+
+	data := Data()
+	if data == old || data.FetchedAt.Before(before) || data.FromSnapshot {
+		t.Errorf("served data after the refresh: fetched at %v, from snapshot %v", data.FetchedAt, data.FromSnapshot)
+	}
+	response := decode[apiPage[Artist]](t, get(t, mux, "/api/v1/artists"))
+	if names := artistNames(response.Items); !slices.Equal(names, []string{"Queen", "Sigur Rós", "Björk"}) {
+		t.Errorf("artists after the refresh: %q", names)
+	}
+	concerts := decode[[]apiConcert](t, get(t, mux, "/api/v1/artists/1/concerts"))
+	if len(concerts) != 3 {
+		t.Errorf("Queen's concerts after the refresh: %+v", concerts)
+	}
+	if recorder := get(t, mux, "/api/v1/artists/2"); recorder.Code != 404 {
+		t.Errorf("removed artist: status %d", recorder.Code)
+	}
+
+	//the old dataset a request may still hold is left as it was
+	if len(old.Artists) != 3 || len(old.Concerts.ByArtist[1]) != 2 {
+		t.Errorf("old dataset changed: %d artists, %d concerts of Queen", len(old.Artists), len(old.Concerts.ByArtist[1]))
+	}
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"groupie/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// everything a data source provides, locations and dates are optional and only used to cross-check the relation data
+type SourceData struct {
+	Artists   []Artist
+	Relations []Relation
+	Locations []Location
+	Dates     []Date
+}
+
+// somewhere the artist data can be loaded from, the upstream API, a directory of JSON files, or data kept in memory
+type DataSource interface {
+	Load() (SourceData, error)
+	Name() string
+	Remote() bool // true if loading goes over the network and can fail for a while, the data is then kept in the snapshot to fall back on
+}
+
+// the upstream groupie tracker API
+const (
+	upstreamArtistsURL   = "https://groupietrackers.herokuapp.com/api/artists"
+	upstreamRelationURL  = "https://groupietrackers.herokuapp.com/api/relation"
+	upstreamLocationsURL = "https://groupietrackers.herokuapp.com/api/locations"
+	upstreamDatesURL     = "https://groupietrackers.herokuapp.com/api/dates"
+)
+
+// loads data from an HTTP API with the same shape as the upstream one, locations and dates are skipped if their URL is empty
+type HTTPSource struct {
+	ArtistsURL   string
+	RelationURL  string
+	LocationsURL string
+	DatesURL     string
+	MaxRetries   int
+	Timeout      time.Duration // timeout of a single request, zero uses the utils default
+	Client       *http.Client  // nil uses http.DefaultClient
+}
+
+// returns a source for the upstream groupie tracker API
+func UpstreamSource() HTTPSource {
+	return HTTPSource{
+		ArtistsURL:   upstreamArtistsURL,
+		RelationURL:  upstreamRelationURL,
+		LocationsURL: upstreamLocationsURL,
+		DatesURL:     upstreamDatesURL,
+		MaxRetries:   20,
+	}
+}
+
+func (source HTTPSource) Name() string {
+	return source.ArtistsURL
+}
+
+func (source HTTPSource) Remote() bool {
+	return true
+}
+
+// returns source with at most maxRetries retries if it's an HTTP source, for when a failure has something to fall back on
+func withFewerRetries(source DataSource, maxRetries int) DataSource {
+	switch httpSource := source.(type) {
+	case HTTPSource:
+		httpSource.MaxRetries = min(httpSource.MaxRetries, maxRetries)
+		return httpSource
+	case *HTTPSource:
+		limited := *httpSource
+		limited.MaxRetries = min(limited.MaxRetries, maxRetries)
+		return limited
+	}
+	return source
+}
+
+// downloads all the endpoints in parallel
+func (source HTTPSource) Load() (SourceData, error) {
+	var artists []Artist
+	var relationData relationResponse
+	var locationData locationResponse
+	var dateData dateResponse
+
+	//every goroutine sends exactly one error (or nil) when it's done,
+	//buffered so the goroutines don't get stuck if we return early on an error
+	errChan := make(chan error, 4)
+
+	options := utils.FetchOptions{
+		Client:     source.Client,
+		Timeout:    source.Timeout,
+		MaxRetries: source.MaxRetries,
+	}
+
+	fetchAsync(source.ArtistsURL, &artists, options, errChan)
+	fetchAsync(source.RelationURL, &relationData, options, errChan)
+	goroutineCount := 2
+	if source.LocationsURL != "" {
+		fetchAsync(source.LocationsURL, &locationData, options, errChan)
+		goroutineCount++
+	}
+	if source.DatesURL != "" {
+		fetchAsync(source.DatesURL, &dateData, options, errChan)
+		goroutineCount++
+	}
+
+	for range goroutineCount {
+		if err := <-errChan; err != nil {
+			return SourceData{}, err
+		}
+	}
+
+	return SourceData{
+		Artists:   artists,
+		Relations: relationData.Relations,
+		Locations: locationData.Locations,
+		Dates:     dateData.Dates,
+	}, nil
+}
+
+// downloads a URL into result in a goroutine, and sends the error (or nil) into errChan when it's done
+func fetchAsync[T any](URL string, result *T, options utils.FetchOptions, errChan chan error) {
+	go func() {
+		_, err := utils.LoadDataFromURLWithOptions(URL, result, options)
+		errChan <- err
+	}()
+}
+
+// loads data from a directory with artists.json and relation.json, and optionally locations.json and dates.json,
+// files in the same format the upstream API responds with
+type DirSource struct {
+	Dir string
+}
+
+func (source DirSource) Name() string {
+	return source.Dir
+}
+
+func (source DirSource) Remote() bool {
+	return false
+}
+
+func (source DirSource) Load() (SourceData, error) {
+	var data SourceData
+
+	err := readJSONFile(filepath.Join(source.Dir, "artists.json"), &data.Artists)
+	if err != nil {
+		return SourceData{}, err
+	}
+
+	var relationData relationResponse
+	err = readJSONFile(filepath.Join(source.Dir, "relation.json"), &relationData)
+	if err != nil {
+		return SourceData{}, err
+	}
+	data.Relations = relationData.Relations
+
+	var locationData locationResponse
+	err = readJSONFile(filepath.Join(source.Dir, "locations.json"), &locationData)
+	if err != nil && !os.IsNotExist(err) {
+		return SourceData{}, err
+	}
+	data.Locations = locationData.Locations
+
+	var dateData dateResponse
+	err = readJSONFile(filepath.Join(source.Dir, "dates.json"), &dateData)
+	if err != nil && !os.IsNotExist(err) {
+		return SourceData{}, err
+	}
+	data.Dates = dateData.Dates
+
+	return data, nil
+}
+
+func readJSONFile(path string, result any) error {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(file, result); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %v", path, err)
+	}
+	return nil
+}
+
+// serves data kept in memory, handy for fixtures
+type FixtureSource struct {
+	Artists   []Artist
+	Relations []Relation
+	Locations []Location
+	Dates     []Date
+}
+
+func (source FixtureSource) Name() string {
+	return "fixture"
+}
+
+func (source FixtureSource) Remote() bool {
+	return false
+}
+
+// returns copies of the slices, so the dataset can't be changed through the fixture
+func (source FixtureSource) Load() (SourceData, error) {
+	return SourceData{
+		Artists:   slices.Clone(source.Artists),
+		Relations: slices.Clone(source.Relations),
+		Locations: slices.Clone(source.Locations),
+		Dates:     slices.Clone(source.Dates),
+	}, nil
+}
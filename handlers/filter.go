@@ -0,0 +1,254 @@
+package api
+
+import (
+	"fmt"
+	"groupie/geocoding"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// year filters that show everything
+const (
+	defaultYearStart = 1956
+	defaultYearEnd   = 2025
+)
+
+// layout of the concert date filters, the same one date inputs use
+const filterDateLayout = "2006-01-02"
+
+// radius used if near is set without radius_km
+const defaultRadiusKm = 100
+
+// reads near and radius_km. The centre is either coordinates or one of the dataset's concert locations.
+// A location that isn't geocoded yet is left unknown, one that's geocoded without usable coordinates is an error
+func parseRadius(request *http.Request, filter *FilterT, data *Dataset) error {
+	near := strings.TrimSpace(request.FormValue("near"))
+	if near == "" {
+		return nil
+	}
+	filter.Near = near
+
+	filter.RadiusKm = defaultRadiusKm
+	if temp := request.FormValue("radius_km"); temp != "" {
+		radius, err := strconv.ParseFloat(temp, 64)
+		if err != nil || radius <= 0 || math.IsInf(radius, 0) {
+			return fmt.Errorf("radius_km must be a positive number, got %q", temp)
+		}
+		filter.RadiusKm = radius
+	}
+
+	//coordinates, "52.52,13.40"
+	if latText, lonText, found := strings.Cut(near, ","); found {
+		latitude, latErr := strconv.ParseFloat(strings.TrimSpace(latText), 64)
+		longitude, lonErr := strconv.ParseFloat(strings.TrimSpace(lonText), 64)
+		if latErr == nil && lonErr == nil {
+			if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+				return fmt.Errorf("near coordinates are out of range, got %q", near)
+			}
+			filter.nearLatitude, filter.nearLongitude, filter.nearKnown = latitude, longitude, true
+			return nil
+		}
+	}
+
+	//a location, as a key or as displayed to the user
+	key, err := normalizeLocationKey(near)
+	if err != nil {
+		return fmt.Errorf("near must be a location like berlin-germany or coordinates like 52.52,13.40, got %q", near)
+	}
+	//only concert locations, so requests can't have anything looked up
+	if _, ok := data.Concerts.ByLocation[key]; !ok {
+		return fmt.Errorf("near must be a concert location or coordinates, there are no concerts at %q", near)
+	}
+	filter.nearLocation = key
+
+	marker, ok := geocoding.CachedMarker(key)
+	if !ok {
+		filter.nearFailure, _ = geocoding.RecentFailure(key)
+		return nil
+	}
+	filter.nearLatitude, filter.nearLongitude, filter.nearKnown = marker.Coordinates()
+	if !filter.nearKnown {
+		return fmt.Errorf("near location %q has no usable coordinates", near)
+	}
+	return nil
+}
+
+// reads the filters out of the request's query (or form), missing values get the defaults that show everything.
+// Request.ParseForm must be called before this
+func parseFilter(request *http.Request, data *Dataset) (FilterT, error) {
+	var err error
+
+	//setting default values:
+	filter := FilterT{
+		CreationYearStart:   defaultYearStart,
+		CreationYearEnd:     defaultYearEnd,
+		FirstAlbumYearStart: defaultYearStart,
+		FirstAlbumYearEnd:   defaultYearEnd,
+		LocationMatch:       "any"}
+
+	tempBandSizeSlice := request.Form["band_size"]
+	if len(tempBandSizeSlice) == 0 {
+		for i := range filter.BandSizeFilterCheckboxes {
+			filter.BandSizeFilterCheckboxes[i] = 1
+			filter.BandSizeFilter = append(filter.BandSizeFilter, 1+i)
+		}
+	} else {
+		for _, checkboxIndexStr := range tempBandSizeSlice {
+			checkboxIndex, err := strconv.Atoi(checkboxIndexStr)
+			if err != nil || checkboxIndex <= 0 || checkboxIndex > 10 {
+				return filter, fmt.Errorf("band_size must be a number from 1 to 10, got %q", checkboxIndexStr)
+			}
+			filter.BandSizeFilterCheckboxes[checkboxIndex-1] = 1 // 1 means that it's on
+			filter.BandSizeFilter = append(filter.BandSizeFilter, checkboxIndex)
+		}
+	}
+
+	yearValues := []struct {
+		name   string
+		target *int
+	}{
+		{"creation_year_start", &filter.CreationYearStart},
+		{"creation_year_end", &filter.CreationYearEnd},
+		{"first_album_year_start", &filter.FirstAlbumYearStart},
+		{"first_album_year_end", &filter.FirstAlbumYearEnd},
+	}
+	for _, value := range yearValues {
+		temp := request.FormValue(value.name)
+		if temp != "" {
+			if *value.target, err = strconv.Atoi(temp); err != nil {
+				return filter, fmt.Errorf("%s must be a year, got %q", value.name, temp)
+			}
+		}
+	}
+
+	//"any" is what the location list shows when nothing is selected
+	for _, location := range request.Form["concert-filter"] {
+		if location != "" && location != "any" {
+			filter.ConcertFilters = append(filter.ConcertFilters, location)
+		}
+	}
+	for _, country := range request.Form["country"] {
+		if country != "" {
+			filter.CountryFilters = append(filter.CountryFilters, country)
+		}
+	}
+	for _, continent := range request.Form["continent"] {
+		if continent != "" {
+			filter.ContinentFilters = append(filter.ContinentFilters, continent)
+		}
+	}
+
+	temp := request.FormValue("location_match")
+	if temp != "" {
+		if temp != "any" && temp != "all" {
+			return filter, fmt.Errorf(`location_match must be "any" or "all", got %q`, temp)
+		}
+		filter.LocationMatch = temp
+	}
+
+	dateValues := []struct {
+		name   string
+		text   *string
+		target *time.Time
+	}{
+		{"concert_date_start", &filter.ConcertDateStart, &filter.concertStart},
+		{"concert_date_end", &filter.ConcertDateEnd, &filter.concertEnd},
+	}
+	for _, value := range dateValues {
+		temp := request.FormValue(value.name)
+		if temp != "" {
+			if *value.target, err = time.Parse(filterDateLayout, temp); err != nil {
+				return filter, fmt.Errorf("%s must be a date like 2019-12-31, got %q", value.name, temp)
+			}
+			*value.text = temp
+		}
+	}
+	if !filter.concertStart.IsZero() && !filter.concertEnd.IsZero() && filter.concertEnd.Before(filter.concertStart) {
+		return filter, fmt.Errorf("concert_date_end can't be before concert_date_start")
+	}
+
+	if err := parseRadius(request, &filter, data); err != nil {
+		return filter, err
+	}
+
+	filter.SearchBar = request.FormValue("searchbar")
+
+	filter.Sort = request.FormValue("sort")
+	if _, ok := sortOptions[filter.Sort]; !ok && filter.Sort != "" {
+		return filter, fmt.Errorf("sort must be one of %s, got %q", strings.Join(sortOptionOrder, ", "), filter.Sort)
+	}
+	filter.Order = "asc"
+	if temp := request.FormValue("order"); temp != "" {
+		if temp != "asc" && temp != "desc" {
+			return filter, fmt.Errorf(`order must be "asc" or "desc", got %q`, temp)
+		}
+		filter.Order = temp
+	}
+
+	return filter, nil
+}
+
+// turns the filter back into query values, leaving out the ones that are the defaults, for links that keep the filters.
+// parseFilter reads the values back into the same filter
+func (filter FilterT) values() url.Values {
+	values := url.Values{}
+
+	if len(filter.BandSizeFilter) != len(filter.BandSizeFilterCheckboxes) {
+		for _, size := range filter.BandSizeFilter {
+			values.Add("band_size", strconv.Itoa(size))
+		}
+	}
+
+	years := []struct {
+		name          string
+		value, normal int
+	}{
+		{"creation_year_start", filter.CreationYearStart, defaultYearStart},
+		{"creation_year_end", filter.CreationYearEnd, defaultYearEnd},
+		{"first_album_year_start", filter.FirstAlbumYearStart, defaultYearStart},
+		{"first_album_year_end", filter.FirstAlbumYearEnd, defaultYearEnd},
+	}
+	for _, year := range years {
+		if year.value != year.normal {
+			values.Set(year.name, strconv.Itoa(year.value))
+		}
+	}
+
+	values["concert-filter"] = filter.ConcertFilters
+	values["country"] = filter.CountryFilters
+	values["continent"] = filter.ContinentFilters
+	if filter.LocationMatch == "all" {
+		values.Set("location_match", "all")
+	}
+
+	optional := map[string]string{
+		"concert_date_start": filter.ConcertDateStart,
+		"concert_date_end":   filter.ConcertDateEnd,
+		"near":               filter.Near,
+		"sort":               filter.Sort,
+		"searchbar":          filter.SearchBar,
+	}
+	for name, value := range optional {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	if filter.Near != "" {
+		values.Set("radius_km", strconv.FormatFloat(filter.RadiusKm, 'f', -1, 64))
+	}
+	if filter.Order == "desc" {
+		values.Set("order", "desc")
+	}
+
+	//empty lists would still show up as "name=" otherwise
+	for name, value := range values {
+		if len(value) == 0 {
+			delete(values, name)
+		}
+	}
+	return values
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"groupie/geocoding"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a small catalog the handler tests run against
+func testFixture() FixtureSource {
+	return FixtureSource{
+		Artists: []Artist{
+			{ID: 1, Name: "Queen", Members: []string{"Freddie Mercury", "Brian May"}, CreationDate: 1970, FirstAlbum: "14-12-1973"},
+			{ID: 2, Name: "Motörhead", Members: []string{"Lemmy Kilmister", "Phil Taylor"}, CreationDate: 1975, FirstAlbum: "21-08-1977"},
+			{ID: 3, Name: "Sigur Rós", Members: []string{"Jónsi Birgisson"}, CreationDate: 1994, FirstAlbum: "01-06-1997"},
+		},
+		Relations: []Relation{
+			{ID: 1, DatesLocations: map[string][]string{"osaka-japan": {"28-01-2020"}, "london-uk": {"10-11-2019"}}},
+			{ID: 2, DatesLocations: map[string][]string{"berlin-germany": {"05-12-2019"}, "sao_paulo-brazil": {"01-03-2020"}}},
+			{ID: 3, DatesLocations: map[string][]string{"reykjavik-iceland": {"12-05-2015"}, "london-uk": {"14-05-2015"}}},
+		},
+	}
+}
+
+// loads source as the current dataset for the rest of the test
+func useFixture(t testing.TB, source FixtureSource) *Dataset {
+	t.Helper()
+
+	data, err := LoadArtistData(source)
+	if err != nil {
+		t.Fatalf("loading fixture: %v", err)
+	}
+
+	previous := Data()
+	SetData(data)
+	t.Cleanup(func() { SetData(previous) })
+	return data
+}
+
+// coordinates the stub geocoder knows, by location key
+var stubMarkers = map[string]geocoding.Marker{
+	"osaka-japan":    {Latitude: "34.6937", Longitude: "135.5023"},
+	"berlin-germany": {Latitude: "52.5200", Longitude: "13.4050"},
+	"atlantis-ocean": {Latitude: "somewhere", Longitude: "deep"}, //geocoded, but without usable coordinates
+}
+
+type stubGeocoder struct{}
+
+func (stubGeocoder) Name() string {
+	return "stub"
+}
+
+func (stubGeocoder) Geocode(location string) (geocoding.Marker, error) {
+	marker, ok := stubMarkers[location]
+	if !ok {
+		return geocoding.Marker{}, geocoding.ErrNotFound
+	}
+	return marker, nil
+}
+
+var startDownloader sync.Once
+
+// geocodes location through the real queue and downloader, with the stub geocoder behind them
+func geocodeForTest(t testing.TB, location string) {
+	t.Helper()
+	startDownloader.Do(func() {
+		geocoding.SetProvider(stubGeocoder{})
+		go geocoding.GeocodeDownloader(context.Background()) //lives as long as the tests do
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := geocoding.FetchCoordinates(ctx, location); err != nil {
+		t.Fatalf("geocoding %s: %v", location, err)
+	}
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"groupie/geocoding"
+	"net/http"
+)
+
+// serves the geocoding queue's depth and counters, how many markers are cached and how many locations couldn't be geocoded
+func GeocodingStatsHandler(writer http.ResponseWriter, request *http.Request) {
+	sendJSON(writer, http.StatusOK, struct {
+		Queue      geocoding.QueueStats `json:"queue"`
+		Cached     int                  `json:"cached"`
+		Unresolved int                  `json:"unresolved"`
+	}{
+		Queue:      geocoding.GeocodingQueue.Stats(),
+		Cached:     geocoding.CachedCount(),
+		Unresolved: geocoding.FailedCount(),
+	})
+}
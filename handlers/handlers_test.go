@@ -0,0 +1,368 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"groupie/geocoding"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sends a GET through handler and returns the recorded response
+func get(t *testing.T, handler http.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", target, nil))
+	return recorder
+}
+
+// the API as the server routes it
+func apiMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+	return mux
+}
+
+func decode[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var value T
+	if err := json.Unmarshal(recorder.Body.Bytes(), &value); err != nil {
+		t.Fatalf("decoding %q: %v", recorder.Body.String(), err)
+	}
+	return value
+}
+
+func artistNames(artists []Artist) []string {
+	names := []string{}
+	for _, artist := range artists {
+		names = append(names, artist.Name)
+	}
+	return names
+}
+
+func TestMainHandler(t *testing.T) {
+	useFixture(t, testFixture())
+	handler := http.HandlerFunc(MainHandler)
+
+	tests := []struct {
+		target   string
+		status   int
+		contains []string
+		excludes []string
+	}{
+		{"/", 200, []string{"Queen", "Motörhead", "Sigur Rós"}, nil},
+		{"/?searchbar=member:freddie", 200, []string{"Queen"}, []string{"Motörhead", "Sigur Rós"}},
+		{"/?concert-filter=Berlin+-+Germany", 200, []string{"Motörhead"}, []string{"Sigur Rós"}},
+		{"/?artistID=3", 200, []string{"Jónsi Birgisson", "Reykjavik"}, nil},
+		{"/?searchbar=name:(queen", 200, []string{"bad search"}, nil},
+		{"/?searchbar=member:freddie+year:1970..&debug=1", 200, []string{"AND(member:&#34;freddie&#34;, year:1970..)", "score "}, nil},
+		{"/?artistID=99", 404, nil, nil},
+		{"/?creation_year_start=soon", 400, nil, nil},
+		{"/nope", 404, nil, nil},
+		{"/?page=9223372036854775807", 200, nil, []string{"Queen"}},
+	}
+	for _, test := range tests {
+		recorder := get(t, handler, test.target)
+		if recorder.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.target, recorder.Code, test.status)
+			continue
+		}
+		body := recorder.Body.String()
+		for _, text := range test.contains {
+			if !strings.Contains(body, text) {
+				t.Errorf("%s: page doesn't contain %q", test.target, text)
+			}
+		}
+		for _, text := range test.excludes {
+			if strings.Contains(body, ">"+text+"<") { //artist names are shown as <p class="cat-name">Queen</p>
+				t.Errorf("%s: page shows %q", test.target, text)
+			}
+		}
+	}
+}
+
+func TestSuggestionsHandler(t *testing.T) {
+	useFixture(t, testFixture())
+	handler := http.HandlerFunc(SuggestionsHandler)
+
+	suggestions := decode[[]Suggestion](t, get(t, handler, "/search?query=fred"))
+	if len(suggestions) == 0 {
+		t.Fatal("no suggestions for fred")
+	}
+	first := suggestions[0]
+	if first.Label != "Freddie Mercury" || first.Kind != kindMember || !slices.Equal(first.ArtistIDs, []int{1}) || first.MatchRange != [2]int{0, 4} {
+		t.Errorf("first suggestion for fred is %+v", first)
+	}
+	if first.Score != 0 {
+		t.Errorf("score sent without debug: %d", first.Score)
+	}
+
+	debug := decode[[]Suggestion](t, get(t, handler, "/search?query=fred&debug=1"))
+	if debug[0].Score == 0 {
+		t.Error("no score in debug mode")
+	}
+
+	values := decode[[]string](t, get(t, handler, "/search?query=motorhead&format=strings"))
+	if !slices.Contains(values, "Motörhead - artist/band") {
+		t.Errorf("legacy suggestions for motorhead: %q", values)
+	}
+
+	if empty := decode[[]Suggestion](t, get(t, handler, "/search?query=zzzz")); len(empty) != 0 {
+		t.Errorf("suggestions for zzzz: %+v", empty)
+	}
+}
+
+// the matched part of labels with diacritics, in characters of the label as it's shown
+func TestMatchRange(t *testing.T) {
+	tests := []struct {
+		label, word string
+		want        [2]int
+	}{
+		{"Motörhead", "motor", [2]int{0, 5}},
+		{"Motörhead", "MOTÖRHEAD", [2]int{0, 9}},
+		{"Sigur Rós", "ros", [2]int{6, 9}},
+		{"São Paulo - Brazil", "sao p", [2]int{0, 5}},
+		{"Beyoncé", "beyonce", [2]int{0, 7}},
+		{"Straße", "strasse", [2]int{0, 6}},
+		{"Straße", "strass", [2]int{0, 5}},
+		{"Mo\u0308tley Cru\u0308e", "crue", [2]int{8, 13}},
+		{"Motley Crue", "crüe", [2]int{7, 11}},
+		{"Timișoara - Romania", "timis", [2]int{0, 5}},
+		{"Hà Nội - Vietnam", "noi", [2]int{3, 6}},
+		{"sao_paulo-brazil", "sao paulo", [2]int{0, 0}},
+	}
+	for _, test := range tests {
+		if got := matchRange(test.label, test.word); got != test.want {
+			t.Errorf("matchRange(%q, %q) = %v, want %v", test.label, test.word, got, test.want)
+		}
+	}
+
+	useFixture(t, testFixture())
+	suggestions := decode[[]Suggestion](t, get(t, http.HandlerFunc(SuggestionsHandler), "/search?query=ro"))
+	i := slices.IndexFunc(suggestions, func(suggestion Suggestion) bool { return suggestion.Label == "Sigur Rós" })
+	if i < 0 || suggestions[i].MatchRange != [2]int{6, 8} {
+		t.Errorf("suggestions for ro: %+v", suggestions)
+	}
+}
+
+func TestAPIArtists(t *testing.T) {
+	useFixture(t, testFixture())
+	mux := apiMux()
+
+	tests := []struct {
+		target string
+		status int
+		names  []string
+	}{
+		{"/api/v1/artists", 200, []string{"Queen", "Motörhead", "Sigur Rós"}},
+		{"/api/v1/artists?sort=creation&order=desc", 200, []string{"Sigur Rós", "Motörhead", "Queen"}},
+		{"/api/v1/artists?country=Iceland", 200, []string{"Sigur Rós"}},
+		{"/api/v1/artists?searchbar=sigur", 200, []string{"Sigur Rós"}},
+		{"/api/v1/artists?concert_date_start=2020-01-01", 200, []string{"Queen", "Motörhead"}},
+		{"/api/v1/artists?concert_date_end=2019-11-10", 200, []string{"Queen", "Sigur Rós"}},
+		{"/api/v1/artists?concert_date_start=2015-05-14&concert_date_end=2015-05-14", 200, []string{"Sigur Rós"}},
+		{"/api/v1/artists?concert_date_start=2016-01-01&concert_date_end=2019-01-01", 200, []string{}},
+		{"/api/v1/locations/london-uk/artists", 200, []string{"Queen", "Sigur Rós"}},
+		{"/api/v1/locations/London%20-%20UK/artists?searchbar=queen", 200, []string{"Queen"}},
+		{"/api/v1/artists?sort=shoe_size", 400, nil},
+		{"/api/v1/artists?searchbar=%22open", 400, nil},
+		{"/api/v1/artists?page=0", 400, nil},
+		{"/api/v1/locations/atlantis-sea/artists", 404, nil},
+	}
+	for _, test := range tests {
+		recorder := get(t, mux, test.target)
+		if recorder.Code != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.target, recorder.Code, test.status, recorder.Body)
+			continue
+		}
+		if test.status != 200 {
+			apiErr := decode[apiError](t, recorder)
+			if apiErr.Error.Status != test.status || apiErr.Error.Message == "" {
+				t.Errorf("%s: error body %+v", test.target, apiErr)
+			}
+			continue
+		}
+		page := decode[apiPage[Artist]](t, recorder)
+		if names := artistNames(page.Items); !slices.Equal(names, test.names) {
+			t.Errorf("%s: artists %q, want %q", test.target, names, test.names)
+		}
+		if page.Total != len(test.names) {
+			t.Errorf("%s: total %d, want %d", test.target, page.Total, len(test.names))
+		}
+	}
+}
+
+func TestAPIPagination(t *testing.T) {
+	useFixture(t, testFixture())
+	mux := apiMux()
+
+	page := decode[apiPage[Artist]](t, get(t, mux, "/api/v1/artists?page_size=2&sort=name"))
+	if page.TotalPages != 2 || len(page.Items) != 2 || page.Prev != "" {
+		t.Fatalf("first page: %+v", page)
+	}
+	if page.Next != "/api/v1/artists?page=2&page_size=2&sort=name" {
+		t.Errorf("next link %q", page.Next)
+	}
+
+	next := decode[apiPage[Artist]](t, get(t, mux, page.Next))
+	if names := artistNames(next.Items); !slices.Equal(names, []string{"Sigur Rós"}) || next.Next != "" || next.Prev == "" {
+		t.Errorf("second page: %+v", next)
+	}
+
+	//a page far past the end is empty and links back to the last page
+	for _, pageSize := range []string{"1", "2", "100"} {
+		recorder := get(t, mux, "/api/v1/artists?page=9223372036854775807&page_size="+pageSize)
+		if recorder.Code != 200 {
+			t.Fatalf("huge page, page_size %s: status %d", pageSize, recorder.Code)
+		}
+		huge := decode[apiPage[Artist]](t, recorder)
+		if len(huge.Items) != 0 || huge.Total != 3 || huge.Next != "" || !strings.Contains(huge.Prev, "page="+strconv.Itoa(huge.TotalPages)) {
+			t.Errorf("huge page, page_size %s: %+v", pageSize, huge)
+		}
+	}
+}
+
+func TestAPIArtistAndConcerts(t *testing.T) {
+	useFixture(t, testFixture())
+	mux := apiMux()
+
+	artist := decode[Artist](t, get(t, mux, "/api/v1/artists/2"))
+	if artist.Name != "Motörhead" || !slices.Equal(artist.Members, []string{"Lemmy Kilmister", "Phil Taylor"}) {
+		t.Errorf("artist 2: %+v", artist)
+	}
+
+	concerts := decode[[]apiConcert](t, get(t, mux, "/api/v1/artists/2/concerts"))
+	if len(concerts) != 2 || concerts[0].Date != "2019-12-05" || concerts[0].Location != "berlin-germany" || concerts[1].City != "Sao Paulo" {
+		t.Errorf("concerts of artist 2: %+v", concerts)
+	}
+
+	for target, status := range map[string]int{
+		"/api/v1/artists/99":          404,
+		"/api/v1/artists/abc":         400,
+		"/api/v1/artists/99/concerts": 404,
+		"/api/v1/nothing":             404,
+	} {
+		if recorder := get(t, mux, target); recorder.Code != status {
+			t.Errorf("%s: status %d, want %d", target, recorder.Code, status)
+		}
+	}
+}
+
+func TestAPILocations(t *testing.T) {
+	useFixture(t, testFixture())
+
+	page := decode[apiPage[apiConcertLocation]](t, get(t, apiMux(), "/api/v1/locations"))
+	if page.Total != 5 {
+		t.Fatalf("%d locations, want 5", page.Total)
+	}
+	for _, location := range page.Items {
+		if location.Location == "london-uk" && (location.ArtistCount != 2 || location.ConcertCount != 2) {
+			t.Errorf("london-uk: %+v", location)
+		}
+	}
+}
+
+func TestAPIConcertsUseCurrentMarkers(t *testing.T) {
+	useFixture(t, testFixture())
+	mux := apiMux()
+
+	//geocoded after the dataset was built
+	geocodeForTest(t, "osaka-japan")
+
+	concerts := decode[[]apiConcert](t, get(t, mux, "/api/v1/artists/1/concerts"))
+	for _, concert := range concerts {
+		if concert.Location == "osaka-japan" && (concert.Latitude != "34.6937" || concert.Longitude != "135.5023") {
+			t.Errorf("osaka-japan has coordinates %q, %q", concert.Latitude, concert.Longitude)
+		}
+	}
+}
+
+func TestAPIRadius(t *testing.T) {
+	fixture := testFixture()
+	fixture.Relations[2].DatesLocations["atlantis-ocean"] = []string{"01-01-2016"}
+	useFixture(t, fixture)
+	mux := apiMux()
+	geocodeForTest(t, "berlin-germany")
+	geocodeForTest(t, "atlantis-ocean")
+
+	recorder := get(t, mux, "/api/v1/artists?near=berlin-germany&radius_km=50")
+	response := decode[apiPage[Artist]](t, recorder)
+	if names := artistNames(response.Items); !slices.Equal(names, []string{"Motörhead"}) {
+		t.Errorf("artists near berlin-germany: %q", names)
+	}
+	if len(response.Warnings) != 1 || !strings.Contains(response.Warnings[0], "skipped by the radius filter") {
+		t.Errorf("warnings near berlin-germany: %q", response.Warnings)
+	}
+	if cacheControl := recorder.Header().Get("Cache-Control"); cacheControl != "no-store" {
+		t.Errorf("near berlin-germany with warnings: Cache-Control %q", cacheControl)
+	}
+
+	//a centre that failed is cooling down, it isn't queued again
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := geocoding.FetchCoordinates(ctx, "sao_paulo-brazil"); !errors.Is(err, geocoding.ErrNotFound) {
+		t.Fatalf("sao_paulo-brazil: %v", err)
+	}
+	queued := geocoding.GeocodingQueue.Stats().Queued
+	response = decode[apiPage[Artist]](t, get(t, mux, "/api/v1/artists?near=sao_paulo-brazil"))
+	if len(response.Items) != 0 || len(response.Warnings) != 1 || !strings.Contains(response.Warnings[0], "sao_paulo-brazil couldn't be geocoded (location not found)") {
+		t.Errorf("near sao_paulo-brazil: %+v", response)
+	}
+	if now := geocoding.GeocodingQueue.Stats().Queued; now != queued {
+		t.Errorf("near sao_paulo-brazil queued %d locations", now-queued)
+	}
+
+	recorder = get(t, mux, "/api/v1/artists?near=atlantis-ocean")
+	if recorder.Code != 400 || !strings.Contains(recorder.Body.String(), "no usable coordinates") {
+		t.Errorf("near atlantis-ocean: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	//only concert locations can be a centre, anything else would be looked up for anyone asking
+	for _, target := range []string{"/api/v1/artists?near=nowhere-land", "/api/v1/locations/london-uk/artists?near=paris-france", "/?near=nowhere-land"} {
+		handler := http.Handler(mux)
+		if !strings.HasPrefix(target, "/api/") {
+			handler = http.HandlerFunc(MainHandler)
+		}
+		if recorder := get(t, handler, target); recorder.Code != 400 {
+			t.Errorf("%s: status %d, want 400", target, recorder.Code)
+		}
+	}
+	if now := geocoding.GeocodingQueue.Stats().Queued; now != queued {
+		t.Errorf("unknown centres queued %d locations", now-queued)
+	}
+}
+
+// a centre that isn't geocoded yet is queued, and the page saying to try again isn't cached
+func TestRadiusCentreQueued(t *testing.T) {
+	//a location no other test, or earlier run of this one, has had looked up
+	centre := fmt.Sprintf("tromso_%d-norway", time.Now().UnixNano())
+	fixture := testFixture()
+	fixture.Relations[2].DatesLocations[centre] = []string{"02-02-2016"}
+	useFixture(t, fixture)
+	geocodeForTest(t, "osaka-japan")
+
+	queued := geocoding.GeocodingQueue.Stats().Queued
+	recorder := get(t, http.HandlerFunc(MainHandler), "/?near="+centre)
+	if recorder.Code != 200 || !strings.Contains(recorder.Body.String(), "try again in a moment") {
+		t.Fatalf("near %s: %d %s", centre, recorder.Code, recorder.Body.String())
+	}
+	if cacheControl := recorder.Header().Get("Cache-Control"); cacheControl != "no-store" {
+		t.Errorf("near %s: Cache-Control %q", centre, cacheControl)
+	}
+	if now := geocoding.GeocodingQueue.Stats().Queued; now != queued+1 {
+		t.Errorf("near %s queued %d locations, want 1", centre, now-queued)
+	}
+
+	//without notes the page can be cached
+	recorder = get(t, http.HandlerFunc(MainHandler), "/?searchbar=queen")
+	if cacheControl := recorder.Header().Get("Cache-Control"); !strings.HasPrefix(cacheControl, "public") {
+		t.Errorf("without notes: Cache-Control %q", cacheControl)
+	}
+}
@@ -1,14 +1,14 @@
 package api
 
 import (
-	"fmt"
-	"groupie/utils"
+	"groupie/geocoding"
 	"log"
 	"net/http"
 	"slices"
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 )
 
 // handler for main page
@@ -18,7 +18,8 @@ func MainHandler(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	writer.Header().Set("Cache-Control", "public, max-age=3600")
+	//take the current dataset once, so the whole page is built from the same data even if a refresh happens meanwhile
+	data := Data()
 
 	err := request.ParseForm()
 	if err != nil {
@@ -26,70 +27,19 @@ func MainHandler(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	//setting default values:
-	filter := FilterT{
-		CreationYearStart:   1956,
-		CreationYearEnd:     2025,
-		FirstAlbumYearStart: 1956,
-		FirstAlbumYearEnd:   2025,
-		ConcertFilter:       "any"}
-
-	tempBandSizeSlice := request.Form["band_size"]
-	if len(tempBandSizeSlice) == 0 {
-		for i := range filter.BandSizeFilterCheckboxes {
-			filter.BandSizeFilterCheckboxes[i] = 1
-			filter.BandSizeFilter = append(filter.BandSizeFilter, 1+i)
-		}
-	} else {
-		for _, checkboxIndexStr := range tempBandSizeSlice {
-			checkboxIndex, err := strconv.Atoi(checkboxIndexStr)
-			if err != nil || checkboxIndex <= 0 || checkboxIndex > 10 {
-				SendErrorPage(writer, 400, "400 - Bad Request <br><br> Bad values in the URL")
-				return
-			}
-			filter.BandSizeFilterCheckboxes[checkboxIndex-1] = 1 // 1 means that it's on
-			filter.BandSizeFilter = append(filter.BandSizeFilter, checkboxIndex)
-		}
-	}
-
-	temp := request.FormValue("creation_year_start")
-	if temp != "" {
-		if filter.CreationYearStart, err = strconv.Atoi(temp); err != nil {
-			SendErrorPage(writer, 400, "400 - Bad Request <br><br> Bad values in the URL")
-			return
-		}
-	}
-
-	temp = request.FormValue("creation_year_end")
-	if temp != "" {
-		if filter.CreationYearEnd, err = strconv.Atoi(temp); err != nil {
-			SendErrorPage(writer, 400, "400 - Bad Request <br><br> Bad values in the URL")
-			return
-		}
-	}
-	temp = request.FormValue("first_album_year_start")
-	if temp != "" {
-		if filter.FirstAlbumYearStart, err = strconv.Atoi(temp); err != nil {
-			SendErrorPage(writer, 400, "400 - Bad Request <br><br> Bad values in the URL")
-			return
-		}
-	}
-	temp = request.FormValue("first_album_year_end")
-	if temp != "" {
-		if filter.FirstAlbumYearEnd, err = strconv.Atoi(temp); err != nil {
-			SendErrorPage(writer, 400, "400 - Bad Request <br><br> Bad values in the URL")
-			return
-		}
+	filter, err := parseFilter(request, data)
+	if err != nil {
+		SendErrorPage(writer, 400, "400 - Bad Request <br><br> Bad values in the URL")
+		return
 	}
+	SearchBar := filter.SearchBar
 
-	temp = request.FormValue("concert-filter")
-	if temp != "" {
-		filter.ConcertFilter = temp
+	page, pageSize, err := parsePagination(request)
+	if err != nil {
+		SendErrorPage(writer, 400, "400 - Bad Request <br><br> Bad values in the URL")
+		return
 	}
 
-	filter.SearchBar = request.FormValue("searchbar")
-	SearchBar := filter.SearchBar
-
 	// Parse the artistID from the query parameters
 	artistIDStr := request.URL.Query().Get("artistID")
 
@@ -97,15 +47,14 @@ func MainHandler(writer http.ResponseWriter, request *http.Request) {
 
 	if artistIDStr != "" {
 		artistID, err = strconv.Atoi(artistIDStr)
-		if err != nil || artistID < -1 || artistID > len(Artists) {
+		if err != nil || artistID < 0 {
 			SendErrorPage(writer, 400, "400 - Bad Request <br><br> Bad values in the URL")
 			return
 		}
 	}
 
 	// Find artist by ID
-	selectedArtist, selectedArtistFound := ArtistMap[artistID]
-	selectedRelation, selectedRelationFound := ArtistRelationMap[artistID]
+	selectedArtist, selectedArtistFound := data.ArtistMap[artistID]
 
 	// If the artist is not found, return a 404 error
 	if !selectedArtistFound && artistID != 0 {
@@ -113,50 +62,88 @@ func MainHandler(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// If relation data is not found, return a 404 error
-	if !selectedRelationFound && artistID != 0 {
-		SendErrorPage(writer, 404, "404 - Relation data not found")
-		return
-	}
-
-	selectedRelation.DatesLocations = utils.FormatMapKeys(selectedRelation.DatesLocations)
-	selectedRelation.DatesLocations = utils.SortDates(selectedRelation.DatesLocations)
-	sortedLocations := utils.SortLocations(selectedRelation.DatesLocations)
+	//only the concerts in the date window, if there is one
+	concertGroups := groupConcerts(filter.concertsInWindow(data.Concerts.ByArtist[artistID]))
 
-	//get all locations to send them for location dropdown filter
-	allLocationsMap := make(map[string][]string)
-	for _, relation := range ArtistRelationMap {
-		for location := range utils.FormatMapKeys(relation.DatesLocations) {
-			allLocationsMap[location] = []string{}
+	//every place concerts happen in, for the location filters
+	continents := []string{}
+	for _, concerts := range data.Concerts.ByCountry {
+		if continent := concerts[0].Continent(); continent != "" && !slices.Contains(continents, continent) {
+			continents = append(continents, continent)
 		}
 	}
-
-	//default options to show all locations
-	allLocations := []string{"any"}
-	allLocations = append(allLocations, utils.SortLocations(allLocationsMap)...)
+	slices.Sort(continents)
 
 	// Filter artists by filters
-	filterReducedArtists := filterArtists(filter, Artists)
+	filterReducedArtists := filterArtists(filter, data)
+	filter.queueGeocoding(data)
+	filterNotes := filter.radiusNotes(data)
 
 	// Filter artists by search query
-	searchReducedArtists := searchFilter(SearchBar, filterReducedArtists)
+	//a search that can't be parsed shows what's wrong with it instead of the artists
+	searchError := ""
+	var searchReducedArtists []Artist
+	var scores map[int]int
+	query, err := parseSearch(SearchBar)
+	if err != nil {
+		searchError = err.Error()
+	} else {
+		searchReducedArtists, scores = searchFilter(query, filterReducedArtists, data)
+	}
+	sortArtists(searchReducedArtists, filter, data, time.Now())
 
-	data := struct {
+	//debug mode shows the search scores and how the search was understood
+	debug := request.FormValue("debug") == "1"
+
+	//page links keep the filters, the selected artist and debug mode
+	linkValues := filter.values()
+	if artistID != 0 {
+		linkValues.Set("artistID", strconv.Itoa(artistID))
+	}
+	if debug {
+		linkValues.Set("debug", "1")
+	}
+	artistPage := paginate(searchReducedArtists, page, pageSize, "/", linkValues)
+
+	parsedQuery := ""
+	if debug && query != nil {
+		parsedQuery = query.String()
+	}
+
+	pageData := struct {
 		Artists          []Artist
+		Pagination       apiPage[Artist]
 		Artist           Artist
-		Relation         Relation
 		SelectedArtistID int
-		SortedLocations  []string
-		AllLocations     []string
+		ConcertGroups    []ConcertGroup
+		LocationOptions  []filterOption
+		CountryOptions   []filterOption
+		ContinentOptions []filterOption
 		Filter           FilterT
+		DataAge          string
+		SearchError      string
+		FilterNotes      []string
+		SortOptions      []sortOption
+		Debug            bool
+		Scores           map[int]int
+		ParsedQuery      string
 	}{
-		Artists:          searchReducedArtists,
+		Artists:          artistPage.Items,
+		Pagination:       artistPage,
 		Artist:           selectedArtist,
-		Relation:         selectedRelation,
 		SelectedArtistID: artistID,
-		SortedLocations:  sortedLocations,
-		AllLocations:     allLocations,
+		ConcertGroups:    concertGroups,
+		LocationOptions:  filterOptions(data.Concerts.Locations, filter.ConcertFilters),
+		CountryOptions:   filterOptions(sortedKeys(data.Concerts.ByCountry), filter.CountryFilters),
+		ContinentOptions: filterOptions(continents, filter.ContinentFilters),
 		Filter:           filter,
+		DataAge:          data.AgeText(),
+		SearchError:      searchError,
+		FilterNotes:      filterNotes,
+		SortOptions:      sortOptionsFor(filter),
+		Debug:            debug,
+		Scores:           scores,
+		ParsedQuery:      parsedQuery,
 	}
 
 	tmpl, err := template.ParseFiles("../templates/index.html")
@@ -165,15 +152,53 @@ func MainHandler(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	if err := tmpl.Execute(writer, data); err != nil {
+	//notes say to try again in a moment, a cached page wouldn't change. Other pages are only cached for a minute,
+	//so refreshed data and newly geocoded locations show up soon
+	if len(filterNotes) > 0 {
+		writer.Header().Set("Cache-Control", "no-store")
+	} else {
+		writer.Header().Set("Cache-Control", "public, max-age=60")
+	}
+
+	if err := tmpl.Execute(writer, pageData); err != nil {
 		log.Printf("Template execution error: %v", err)
 	}
 }
 
+// an option of a filter where more than one can be picked
+type filterOption struct {
+	Value    string
+	Selected bool
+}
+
+func filterOptions(values, selected []string) []filterOption {
+	options := make([]filterOption, 0, len(values))
+	for _, value := range values {
+		options = append(options, filterOption{Value: value, Selected: slices.Contains(selected, value)})
+	}
+	return options
+}
+
+// queues what the radius filter is missing for download, so later requests can use it: the centre first, since the
+// user retries as soon as it's known, and once the centre is known the concert locations the filter had to skip.
+// A centre cooling down after a failed lookup isn't queued again
+func (filter FilterT) queueGeocoding(data *Dataset) {
+	if !filter.hasRadius() || filter.nearFailure != nil {
+		return
+	}
+	if !filter.nearKnown {
+		geocoding.QueueLocation(filter.nearLocation, geocoding.PriorityWaiting)
+		return
+	}
+	for _, concert := range filter.ungeocodedConcerts(data) {
+		geocoding.QueueLocation(concert.Location, geocoding.PriorityBackground)
+	}
+}
+
 // returns artists that match all through all the filters
-func filterArtists(filter FilterT, artists []Artist) []Artist {
+func filterArtists(filter FilterT, data *Dataset) []Artist {
 	newArtistSlice := []Artist{}
-	for _, artist := range artists {
+	for _, artist := range data.Artists {
 
 		//BAND SIZE FILTER
 		if !slices.Contains(filter.BandSizeFilter, len(artist.Members)) {
@@ -186,251 +211,57 @@ func filterArtists(filter FilterT, artists []Artist) []Artist {
 		}
 
 		//FIRST ALBUM FILTER
-		fullDate := fmt.Sprint(artist.FirstAlbum)
-		parts := strings.Split(fullDate, "-")
-		year := parts[2]
-		if year > fmt.Sprint(filter.FirstAlbumYearEnd) || year < fmt.Sprint(filter.FirstAlbumYearStart) {
+		year := artist.FirstAlbumDate.Year()
+		if year > filter.FirstAlbumYearEnd || year < filter.FirstAlbumYearStart {
 			continue
 		}
 
-		//CONCERT FILTER
-		if filter.ConcertFilter != "any" {
-
-			found := false
-			for key := range ArtistRelationMap[artist.ID].DatesLocations {
-				if utils.FixKey(key) == filter.ConcertFilter {
-					found = true
-					break
-				}
-			}
-			if !found {
-				continue
-			}
+		//CONCERT DATE FILTER
+		concerts := filter.concertsInWindow(data.Concerts.ByArtist[artist.ID])
+		if filter.hasConcertWindow() && len(concerts) == 0 {
+			continue
 		}
 
-		newArtistSlice = append(newArtistSlice, artist)
-	}
-
-	return newArtistSlice
-}
-
-// returns artists that match at least one of the search criteria
-func searchFilter(searchText string, artists []Artist) []Artist {
-	if searchText == "" {
-		return artists
-	}
-	newArtistSlice := []Artist{}
-	for _, artist := range artists {
-		_, ok := searchMatch(searchText, artist)
-		if ok {
-			newArtistSlice = append(newArtistSlice, artist)
+		//CONCERT LOCATION FILTER, concerts at the selected locations, countries and continents inside the date window if there is one
+		if filter.hasLocationFilter() && !filter.matchesLocations(concerts) {
+			continue
 		}
-	}
-	return newArtistSlice
-}
 
-// returns which artist fields match the search query
-func searchMatch(searchWord string, artist Artist) ([]string, bool) {
-
-	doFlags := struct {
-		artist     bool
-		member     bool
-		creation   bool
-		firstAlbum bool
-		concert    bool
-	}{}
-
-	//trim query in case there's stuff left from suggestion autocomplete
-	searchWord = strings.TrimSpace(searchWord)
-
-	//check for suffixes, and set up flags to only find results that these tags demand
-	switch {
-	case strings.HasSuffix(searchWord, " - artist/band"):
-		doFlags.artist = true
-		searchWord = strings.TrimSuffix(searchWord, " - artist/band")
-
-	case strings.HasSuffix(searchWord, " - member"):
-		doFlags.member = true
-		searchWord = strings.TrimSuffix(searchWord, " - member")
-
-	case strings.HasSuffix(searchWord, " - creation date"):
-		doFlags.creation = true
-		searchWord = strings.TrimSuffix(searchWord, " - creation date")
-
-	case strings.HasSuffix(searchWord, " - first album"):
-		doFlags.firstAlbum = true
-		searchWord = strings.TrimSuffix(searchWord, " - first album")
-
-	case strings.HasSuffix(searchWord, " - concert location"):
-		doFlags.concert = true
-		searchWord = strings.TrimSuffix(searchWord, " - concert location")
-
-	default:
-		doFlags.artist = true
-		doFlags.member = true
-		doFlags.creation = true
-		doFlags.firstAlbum = true
-		doFlags.concert = true
-	}
-
-	searchWord = strings.TrimSpace(searchWord)
-
-	//all the matches that matched this particular artist
-	matches := []string{}
-
-	// check full artist name
-
-	if doFlags.artist && isArtistMatch(searchWord, artist) {
-		matches = append(matches, fmt.Sprint(artist.Name+" - artist/band"))
-	}
-
-	//member
-	if doFlags.member {
-		matchesMembers, ok := areMembersMatch(searchWord, artist)
-		if ok {
-			matches = append(matches, matchesMembers...)
+		//RADIUS FILTER, a concert near the centre inside the date window if there is one
+		if filter.hasRadius() && !slices.ContainsFunc(concerts, filter.inRadius) {
+			continue
 		}
-	}
-
-	//creation date
-	if doFlags.creation && isCreationDateMatch(searchWord, artist) {
-		matches = append(matches, fmt.Sprint(artist.CreationDate, " - creation date"))
-	}
 
-	//first album
-	if doFlags.firstAlbum && isFirstAlbumMatch(searchWord, artist) {
-		matches = append(matches, fmt.Sprint(artist.FirstAlbum, " - first album"))
-	}
-
-	//check first album date
-	if doFlags.concert {
-		someMatches, ok := isLocationMatch(searchWord, artist)
-		if ok {
-			matches = append(matches, someMatches...)
-		}
+		newArtistSlice = append(newArtistSlice, artist)
 	}
 
-	match := len(matches) > 0
-	return matches, match
-}
-
-func isArtistMatch(searchWord string, artist Artist) bool {
-	if utils.SameEnough(artist.Name, searchWord) {
-		//MATCH FOUND
-		return true
-
-	} else {
-		//check each "word" of artist name
-		for _, namePart := range utils.SplitByWords(artist.Name) {
-			if utils.SameEnough(namePart, searchWord) {
-				//MATCH FOUND
-				return true
-			}
-		}
-	}
-	return false
+	return newArtistSlice
 }
 
-func areMembersMatch(searchWord string, artist Artist) ([]string, bool) {
-
-	matches := []string{}
-nextMember:
-	for _, memberName := range artist.Members {
-		//check full member name
-		if utils.SameEnough(memberName, searchWord) {
-			//MATCH FOUND
-			matches = append(matches, fmt.Sprint(memberName+" - member"))
-			continue
-
-		} else {
-			//check each word of member name
-			for _, namePart := range utils.SplitByWords(memberName) {
-				if utils.SameEnough(namePart, searchWord) {
-					//MATCH FOUND
-					matches = append(matches, fmt.Sprint(memberName+" - member"))
-					continue nextMember
-				}
-			}
-		}
-	}
-	return matches, len(matches) > 0
-}
-func isFirstAlbumMatch(searchWord string, artist Artist) bool {
-	if utils.SameEnough(artist.FirstAlbum, searchWord) {
-		//MATCH FOUND
-		return true
-	} else {
-		//check each part of the first album date, day, month, year
-		for _, datePart := range utils.SplitByWords(artist.FirstAlbum) {
-			if utils.SameEnough(datePart, searchWord) {
-				//MATCH FOUND
-				return true
-			}
-		}
+// parses the search bar text, an empty search bar is a nil query.
+// The error is a *QueryError if the query can't be parsed
+func parseSearch(searchText string) (queryNode, error) {
+	if strings.TrimSpace(searchText) == "" {
+		return nil, nil
 	}
-	return false
+	return parseQuery(searchText)
 }
 
-func isCreationDateMatch(searchWord string, artist Artist) bool {
-	if utils.SameEnough(fmt.Sprint(artist.CreationDate), searchWord) {
-		//MATCH FOUND
-		return true
+// returns artists that match the search bar query, the most relevant first, and their scores by artist ID.
+// Artists that score the same stay in the order they came in, a nil query matches them all
+func searchFilter(query queryNode, artists []Artist, data *Dataset) ([]Artist, map[int]int) {
+	if query == nil {
+		return artists, map[int]int{}
 	}
-	return false
-}
-
-func isLocationMatch(searchWord string, artist Artist) ([]string, bool) {
-	matches := []string{}
-	//check each concert location
-nextLocation:
-	for location := range ArtistRelationMap[artist.ID].DatesLocations {
-
-		//check full concert location name
-		if utils.SameEnough(location, searchWord) {
-			//MATCH FOUND
-			matches = append(matches, fmt.Sprint(location, " - concert location"))
-			continue
-
-			//check full concert location name bug with location format same as what is visually displayed to user
-		} else if utils.SameEnough(utils.FixKey(location), searchWord) {
-			matches = append(matches, fmt.Sprint(utils.FixKey(location), " - concert location"))
-			continue
-
-			//checl full concert name, unformatted, but replace "-" with " ", so instad of "osaka-japan" it's "osaka japan"
-		} else if utils.SameEnough(strings.Replace(location, "-", " ", -1), searchWord) {
-			matches = append(matches, fmt.Sprint(strings.Replace(location, "-", " ", -1), " - concert location"))
-			continue
-
-		} else {
-			//check each part of concert name
-			for _, locationPart := range utils.SplitByWords(location) {
-				if utils.SameEnough(locationPart, searchWord) {
-					//MATCH FOUND
-					matches = append(matches, fmt.Sprint(location, " - concert location"))
-					continue nextLocation
-				}
-			}
-
-			//check each part of concert name, formatted the same way as is displayed to user
-			for _, locationPart := range utils.SplitByWords(utils.FixKey(location)) {
-				if utils.SameEnough(locationPart, searchWord) {
-					//MATCH FOUND
-					matches = append(matches, fmt.Sprint(utils.FixKey(location), " - concert location"))
-					continue nextLocation
-				}
-			}
-
-			//check each part of concert name, with "-" replaced with " "
-			for _, locationPart := range utils.SplitByWords(strings.Replace(location, "-", " ", -1)) {
-				if utils.SameEnough(locationPart, searchWord) {
-					//MATCH FOUND
-					matches = append(matches, fmt.Sprint(strings.Replace(location, "-", " ", -1), " - concert location"))
-					continue nextLocation
-				}
-			}
-
+	scores := query.eval(data)
+	newArtistSlice := []Artist{}
+	for _, artist := range artists {
+		if _, ok := scores[artist.ID]; ok {
+			newArtistSlice = append(newArtistSlice, artist)
 		}
 	}
-
-	return matches, len(matches) > 0
+	slices.SortStableFunc(newArtistSlice, func(a, b Artist) int {
+		return scores[b.ID] - scores[a.ID]
+	})
+	return newArtistSlice, scores
 }
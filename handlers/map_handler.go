@@ -35,7 +35,7 @@ func MapHandler(writer http.ResponseWriter, request *http.Request) {
 		Display string
 	}{
 		ID:      artistIDStr,
-		Display: fmt.Sprintf("%s's Concerts", ArtistMap[artistIDint].Name),
+		Display: fmt.Sprintf("%s's Concerts", Data().ArtistMap[artistIDint].Name),
 	}
 
 	if err := tmpl.Execute(writer, data); err != nil {
@@ -1,13 +1,32 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"groupie/geocoding"
+	"groupie/utils"
 	"net/http"
 	"strconv"
 	"time"
 )
 
+// an event of the marker stream, every value is a string, "finished" is "true" on the last event
+type markerEvent struct {
+	Latitude  string `json:"lat"`
+	Longitude string `json:"lon"`
+	Location  string `json:"location"`
+	Finished  string `json:"finished"`
+}
+
+// an "unresolved" event of the marker stream, for a location that couldn't be placed on the map
+type unresolvedEvent struct {
+	Location string `json:"location"`
+	Reason   string `json:"reason"`
+	RetryAt  string `json:"retryAt,omitempty"` // RFC 3339, when the location will be looked up again
+}
+
 // handler for map marker requests, can respond multiple times to an SSE, asynchronously as the markers are fetched for an API
 func MarkerHandler(writer http.ResponseWriter, request *http.Request) {
 	artistIDstr := request.URL.Query().Get("artistID")
@@ -19,15 +38,14 @@ func MarkerHandler(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	dateLocations := ArtistRelationMap[artistID].DatesLocations
-
-	channel := make(chan geocoding.Marker)
+	locations := concertLocations(Data().Concerts.ByArtist[artistID])
 
-	goroutineCount := len(dateLocations)
+	//buffered so the goroutines can finish even if the client is gone
+	channel := make(chan markerResult, len(locations))
 
 	//sending goroutines that will call fetchCoordinates and then put the result into a channel
-	for location := range dateLocations {
-		go findMarker(channel, location)
+	for _, location := range locations {
+		go findMarker(request.Context(), channel, location)
 	}
 
 	// Set headers for SSE
@@ -35,31 +53,39 @@ func MarkerHandler(writer http.ResponseWriter, request *http.Request) {
 	writer.Header().Set("Cache-Control", "no-cache")
 	writer.Header().Set("Connection", "keep-alive")
 
-	for marker := range channel {
-		// do stuff with marker from goroutine
-		payload := fmt.Sprintf(
-			"data: {\"lat\": \"%s\", \"lon\": \"%s\", \"location\": \"%s\", \"finished\": \"%s\"}\n\n",
-			marker.Latitude, marker.Longitude, marker.Location, "false",
-		)
-		_, err := fmt.Fprint(writer, payload)
+	for range locations {
+		result := <-channel
+		if result.err != nil {
+			if request.Context().Err() != nil {
+				return //client went away
+			}
+			fmt.Println(result.err)
+			err := sendUnresolvedEvent(writer, result.err)
+			if err != nil {
+				fmt.Println("error trying to fprint the markers: ", err)
+				return
+			}
+			writer.(http.Flusher).Flush()
+			continue
+		}
+
+		marker := result.marker
+		err := sendMarkerEvent(writer, markerEvent{
+			Latitude:  marker.Latitude,
+			Longitude: marker.Longitude,
+			Location:  marker.Location,
+			Finished:  "false",
+		})
 		if err != nil {
 			fmt.Println("error trying to fprint the markers: ", err)
 			return
 		}
 		writer.(http.Flusher).Flush()
-		goroutineCount--
-		if goroutineCount == 0 {
-			close(channel)
-		}
 		time.Sleep(time.Millisecond * 300)
 	}
 
 	//ONE LAST SEND TO TELL THE JAVASCRIPT THAT ALL MARKERS ARE FINISHED
-	payload := fmt.Sprintf(
-		"data: {\"lat\": \"%s\", \"lon\": \"%s\", \"location\": \"%s\", \"finished\": \"%s\"}\n\n",
-		"", "", "", "true",
-	)
-	_, err = fmt.Fprint(writer, payload)
+	err = sendMarkerEvent(writer, markerEvent{Finished: "true"})
 	if err != nil {
 		fmt.Println("error trying to fprint the markers: ", err)
 		return
@@ -68,12 +94,55 @@ func MarkerHandler(writer http.ResponseWriter, request *http.Request) {
 
 }
 
-// goroutine that will returns the marker, when it's ready
-func findMarker(channel chan geocoding.Marker, location string) {
-	marker, err := geocoding.FetchCoordinates(location)
+// writes a single server-sent event
+func sendMarkerEvent(writer http.ResponseWriter, event markerEvent) error {
+	jsonData, err := json.Marshal(event)
 	if err != nil {
-		fmt.Println(location, ": ", err)
-		return
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "data: %s\n\n", jsonData)
+	return err
+}
+
+// why a location couldn't be geocoded, as the user is told.
+// The provider's errors stay in the log, they're about our requests and mean nothing to the user
+func unresolvedReason(err error) string {
+	switch {
+	case errors.Is(err, geocoding.ErrNotFound):
+		return "location not found"
+	case errors.Is(err, geocoding.ErrQueueFull):
+		return "too many locations are waiting to be geocoded"
 	}
-	channel <- marker
+	return "the geocoder failed"
+}
+
+// writes an "unresolved" server-sent event, a named event so clients that only handle markers don't mistake it for one
+func sendUnresolvedEvent(writer http.ResponseWriter, fetchErr error) error {
+	event := unresolvedEvent{Reason: unresolvedReason(fetchErr)}
+	var geocodeErr *geocoding.GeocodeError
+	if errors.As(fetchErr, &geocodeErr) {
+		event.Location = utils.FixKey(geocodeErr.Location)
+		if !geocodeErr.RetryAt.IsZero() {
+			event.RetryAt = geocodeErr.RetryAt.Format(time.RFC3339)
+		}
+	}
+
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "event: unresolved\ndata: %s\n\n", jsonData)
+	return err
+}
+
+// a marker or the reason there isn't one
+type markerResult struct {
+	marker geocoding.Marker
+	err    error
+}
+
+// goroutine that will returns the marker, when it's ready, or the error if it can't be found
+func findMarker(ctx context.Context, channel chan markerResult, location string) {
+	marker, err := geocoding.FetchCoordinates(ctx, location)
+	channel <- markerResult{marker: marker, err: err}
 }
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"fmt"
+	"groupie/geocoding"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// OpenAPI 3 description of the JSON endpoints, served at /api/openapi.json.
+// The schemas are generated from the Go types the handlers respond with, so they can't drift apart from them
+
+// the filters of the main page, used by every artist listing
+var filterParameters = []map[string]any{
+	queryParameter("band_size", "Member counts to keep, repeat the parameter for more than one. All of them if missing",
+		map[string]any{"type": "array", "items": map[string]any{"type": "integer", "minimum": 1, "maximum": 10}}),
+	queryParameter("creation_year_start", "Earliest creation year", map[string]any{"type": "integer", "default": defaultYearStart}),
+	queryParameter("creation_year_end", "Latest creation year", map[string]any{"type": "integer", "default": defaultYearEnd}),
+	queryParameter("first_album_year_start", "Earliest first album year", map[string]any{"type": "integer", "default": defaultYearStart}),
+	queryParameter("first_album_year_end", "Latest first album year", map[string]any{"type": "integer", "default": defaultYearEnd}),
+	queryParameter("concert-filter", `Concert locations as displayed to the user ("Osaka - Japan"), repeat the parameter for more than one. "any" is ignored`,
+		map[string]any{"type": "array", "items": map[string]any{"type": "string"}}),
+	queryParameter("country", `Concert countries as displayed to the user ("Japan"), repeat the parameter for more than one`,
+		map[string]any{"type": "array", "items": map[string]any{"type": "string"}}),
+	queryParameter("continent", "Concert continents, repeat the parameter for more than one",
+		map[string]any{"type": "array", "items": map[string]any{"type": "string", "enum": sortedKeys(continentCountries)}}),
+	queryParameter("location_match", `"any" keeps artists with a concert in at least one of the selected locations, countries and continents, "all" only the ones with concerts in every one of them`,
+		map[string]any{"type": "string", "enum": []string{"any", "all"}, "default": "any"}),
+	queryParameter("concert_date_start", "Only artists with a concert on this day or later", map[string]any{"type": "string", "format": "date"}),
+	queryParameter("concert_date_end", "Only artists with a concert on this day or earlier", map[string]any{"type": "string", "format": "date"}),
+	queryParameter("near", `Centre of the radius filter, a concert location ("berlin-germany" or "Berlin - Germany") or coordinates ("52.52,13.40"), anything else is a bad request. `+
+		"Only geocoded locations can be checked, the ones that aren't are listed in the warnings", map[string]any{"type": "string"}),
+	queryParameter("radius_km", "How far from near a concert can be", map[string]any{"type": "number", "minimum": 0, "exclusiveMinimum": true, "default": defaultRadiusKm}),
+	queryParameter("sort", "Order of the artists, by relevance (or upstream order without a search) if missing. "+
+		"Concerts only count inside the concert date window, artists without a next or last concert come last",
+		map[string]any{"type": "string", "enum": sortOptionOrder}),
+	queryParameter("order", "Sort direction", map[string]any{"type": "string", "enum": []string{"asc", "desc"}, "default": "asc"}),
+	queryParameter("searchbar", "Search text, the same as the main page's search bar. When it's set the most relevant artists come first. "+
+		"Takes the search query language, like `member:freddie country:japan year:1970..1980 -name:queen`, with AND, OR, NOT, brackets and quoted phrases. "+
+		"Fields: "+queryFieldsDescription()+". A search that can't be parsed responds with 400", map[string]any{"type": "string"}),
+}
+
+var paginationParameters = []map[string]any{
+	queryParameter("page", "Page number, starting from 1", map[string]any{"type": "integer", "minimum": 1, "default": 1}),
+	queryParameter("page_size", "Items per page", map[string]any{"type": "integer", "minimum": 1, "maximum": maxPageSize, "default": defaultPageSize}),
+}
+
+func queryParameter(name, description string, schema map[string]any) map[string]any {
+	return map[string]any{"name": name, "in": "query", "required": false, "description": description, "schema": schema}
+}
+
+func pathParameter(name, description string, schema map[string]any) map[string]any {
+	return map[string]any{"name": name, "in": "path", "required": true, "description": description, "schema": schema}
+}
+
+// generates JSON schemas out of Go types, named structs go into the components and are referenced from there
+type schemaGenerator struct {
+	components map[string]any
+}
+
+func (generator *schemaGenerator) schema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return generator.schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": generator.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": generator.schema(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := generator.components[name]; !ok {
+			generator.components[name] = nil //placeholder, in case the type refers to itself
+			generator.components[name] = generator.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+func (generator *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = generator.schema(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
+
+// name of a type in the components, "apiConcert" is "Concert" and "apiPage[...Artist]" is "ArtistPage"
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if start := strings.Index(name, "["); start >= 0 {
+		inner := name[start+1 : len(name)-1]
+		inner = inner[strings.LastIndex(inner, ".")+1:]
+		return publicName(inner) + "Page"
+	}
+	return publicName(name)
+}
+
+func publicName(name string) string {
+	name = strings.TrimPrefix(name, "api")
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func jsonResponse(description string, schema map[string]any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content":     map[string]any{"application/json": map[string]any{"schema": schema}},
+	}
+}
+
+// builds the whole OpenAPI document
+func openAPISpec() map[string]any {
+	generator := &schemaGenerator{components: map[string]any{}}
+	schema := func(value any) map[string]any {
+		return generator.schema(reflect.TypeOf(value))
+	}
+
+	errorResponse := func(description string) map[string]any {
+		return jsonResponse(description, schema(apiError{}))
+	}
+	artistIDPath := pathParameter("id", "Artist ID", map[string]any{"type": "integer"})
+	listing := func(extra ...map[string]any) []map[string]any {
+		parameters := append([]map[string]any{}, extra...)
+		parameters = append(parameters, filterParameters...)
+		return append(parameters, paginationParameters...)
+	}
+
+	paths := map[string]any{
+		"/search": map[string]any{"get": map[string]any{
+			"summary": "Search suggestions for the search bar",
+			"parameters": []map[string]any{
+				queryParameter("query", "What the user has typed so far", map[string]any{"type": "string"}),
+				queryParameter("format", `"strings" responds with the old format, the suggestion values like "Queen - artist/band"`, map[string]any{"type": "string", "enum": []string{"strings"}}),
+				queryParameter("debug", `"1" adds the relevance score to every suggestion`, map[string]any{"type": "string", "enum": []string{"1"}}),
+			},
+			"responses": map[string]any{
+				"200": jsonResponse(fmt.Sprintf("At most %d suggestions, the most relevant first and then by kind and alphabetically. "+
+					"Exact prefix matches always come before ones with typos. Strings if format=strings", maxSuggestions),
+					map[string]any{"oneOf": []any{schema([]Suggestion{}), schema([]string{})}}),
+			},
+		}},
+		"/markerHandler": map[string]any{"get": map[string]any{
+			"summary":    "Server-sent events with the map markers of an artist's concert locations, one event per location as it's geocoded",
+			"parameters": []map[string]any{queryParameter("artistID", "Artist ID", map[string]any{"type": "integer"})},
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": `Stream of server-sent events. Markers are unnamed "data: {json}" events (MarkerEvent), the last one has "finished": "true" and empty coordinates. ` +
+						`Locations that couldn't be geocoded are "event: unresolved" events (UnresolvedEvent) with the reason, and when they'll be looked up again (RFC 3339) if that's known`,
+					"content": map[string]any{"text/event-stream": map[string]any{"schema": map[string]any{"oneOf": []any{schema(markerEvent{}), schema(unresolvedEvent{})}}}},
+				},
+			},
+		}},
+		"/data-quality": map[string]any{"get": map[string]any{
+			"summary":   "Inconsistencies found when cross-checking the relation, locations and dates data",
+			"responses": map[string]any{"200": jsonResponse("The report", schema(QualityReport{}))},
+		}},
+		"/api/v1/artists": map[string]any{"get": map[string]any{
+			"summary":    "Artists matching the filters",
+			"parameters": listing(),
+			"responses": map[string]any{
+				"200": jsonResponse("One page of artists", schema(apiPage[Artist]{})),
+				"400": errorResponse("Bad filter or pagination values"),
+			},
+		}},
+		"/api/v1/artists/{id}": map[string]any{"get": map[string]any{
+			"summary":    "A single artist",
+			"parameters": []map[string]any{artistIDPath},
+			"responses": map[string]any{
+				"200": jsonResponse("The artist", schema(Artist{})),
+				"400": errorResponse("The ID isn't a number"),
+				"404": errorResponse("No artist with this ID"),
+			},
+		}},
+		"/api/v1/artists/{id}/concerts": map[string]any{"get": map[string]any{
+			"summary":    "An artist's concerts, ordered by date",
+			"parameters": []map[string]any{artistIDPath},
+			"responses": map[string]any{
+				"200": jsonResponse("The concerts", schema([]apiConcert{})),
+				"400": errorResponse("The ID isn't a number"),
+				"404": errorResponse("No artist with this ID"),
+			},
+		}},
+		"/api/v1/locations": map[string]any{"get": map[string]any{
+			"summary":    "Every concert location, ordered by country and city",
+			"parameters": paginationParameters,
+			"responses": map[string]any{
+				"200": jsonResponse("One page of locations", schema(apiPage[apiConcertLocation]{})),
+				"400": errorResponse("Bad pagination values"),
+			},
+		}},
+		"/api/v1/locations/{key}/artists": map[string]any{"get": map[string]any{
+			"summary":    "Artists with a concert at the location, matching the filters",
+			"parameters": listing(pathParameter("key", `Location key, "osaka-japan"`, map[string]any{"type": "string"})),
+			"responses": map[string]any{
+				"200": jsonResponse("One page of artists", schema(apiPage[Artist]{})),
+				"400": errorResponse("Bad location key, filter or pagination values"),
+				"404": errorResponse("No concerts at this location"),
+			},
+		}},
+	}
+
+	//not returned by any endpoint as they are, but the frontend works with their shapes
+	schema(Relation{})
+	schema(geocoding.Marker{})
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Groupie Tracker",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": generator.components},
+	}
+}
+
+// serves the OpenAPI document
+func OpenAPIHandler(writer http.ResponseWriter, request *http.Request) {
+	sendJSON(writer, http.StatusOK, openAPISpec())
+}
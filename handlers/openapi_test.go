@@ -0,0 +1,324 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// values for the documented parameters that the handlers take as valid, by name
+var exampleParameters = map[string]string{
+	"near":           "52.52,13.40",
+	"searchbar":      "queen",
+	"concert-filter": "London - UK",
+	"country":        "UK",
+	"continent":      "Europe",
+	"query":          "que",
+	"artistID":       "1",
+	"id":             "1",
+	"key":            "london-uk",
+}
+
+// a valid value for a documented parameter, from the examples above or out of its schema
+func exampleValue(parameter map[string]any) string {
+	if value, ok := exampleParameters[parameter["name"].(string)]; ok {
+		return value
+	}
+	schema := parameter["schema"].(map[string]any)
+	if items, ok := schema["items"].(map[string]any); ok {
+		schema = items
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		return fmt.Sprint(enum[0])
+	}
+	if value, ok := schema["default"]; ok {
+		return fmt.Sprint(value)
+	}
+	if minimum, ok := schema["minimum"]; ok {
+		return fmt.Sprint(minimum)
+	}
+	if schema["format"] == "date" {
+		return "2019-01-01"
+	}
+	return "1"
+}
+
+// checks value against a schema of the document, returns what doesn't match
+func schemaErrors(document map[string]any, schema map[string]any, value any, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		resolved, ok := document["components"].(map[string]any)["schemas"].(map[string]any)[name].(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %s isn't in the components", at, ref)}
+		}
+		return schemaErrors(document, resolved, value, at)
+	}
+
+	if options, ok := schema["oneOf"].([]any); ok {
+		for _, option := range options {
+			if len(schemaErrors(document, option.(map[string]any), value, at)) == 0 {
+				return nil
+			}
+		}
+		return []string{fmt.Sprintf("%s: %v matches none of the schemas", at, value)}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		return []string{fmt.Sprintf("%s: %v isn't one of %v", at, value, enum)}
+	}
+
+	errors := []string{}
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %v isn't an object", at, value)}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				errors = append(errors, fmt.Sprintf("%s: %s is missing", at, name))
+			}
+		}
+		for name, field := range object {
+			if propertySchema, ok := properties[name].(map[string]any); ok {
+				errors = append(errors, schemaErrors(document, propertySchema, field, at+"."+name)...)
+			} else if additional, ok := schema["additionalProperties"].(map[string]any); ok {
+				errors = append(errors, schemaErrors(document, additional, field, at+"."+name)...)
+			} else {
+				errors = append(errors, fmt.Sprintf("%s: %s isn't documented", at, name))
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %v isn't an array", at, value)}
+		}
+		for i, item := range array {
+			errors = append(errors, schemaErrors(document, schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			errors = append(errors, fmt.Sprintf("%s: %v isn't a string", at, value))
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != math.Trunc(number) {
+			errors = append(errors, fmt.Sprintf("%s: %v isn't an integer", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			errors = append(errors, fmt.Sprintf("%s: %v isn't a number", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errors = append(errors, fmt.Sprintf("%s: %v isn't a boolean", at, value))
+		}
+	}
+	return errors
+}
+
+// the OpenAPI document as the server sends it
+func openAPIDocument(t *testing.T) map[string]any {
+	t.Helper()
+	recorder := get(t, apiMux(), "/api/openapi.json")
+	if recorder.Code != 200 {
+		t.Fatalf("/api/openapi.json: status %d", recorder.Code)
+	}
+	return decode[map[string]any](t, recorder)
+}
+
+// every documented route, routed like the server does
+func documentedMux() *http.ServeMux {
+	mux := apiMux()
+	mux.HandleFunc("/search", SuggestionsHandler)
+	mux.HandleFunc("/markerHandler", MarkerHandler)
+	mux.HandleFunc("/data-quality", DataQualityHandler)
+	return mux
+}
+
+// a server-sent event
+type sentEvent struct {
+	name string // "" for unnamed events
+	data string
+}
+
+func parseEvents(body string) []sentEvent {
+	events := []sentEvent{}
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		event := sentEvent{}
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event.name = name
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+				event.data = data
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// the handlers respond the way the OpenAPI document describes: with the documented statuses,
+// taking the documented parameters, and with bodies that match the documented schemas
+func TestOpenAPIMatchesHandlers(t *testing.T) {
+	useFixture(t, testFixture())
+	geocodeForTest(t, "osaka-japan") //london-uk isn't found, so the marker stream has an unresolved event too
+	document := openAPIDocument(t)
+	mux := documentedMux()
+
+	tests := []struct {
+		path   string // as documented
+		target string
+		status int
+	}{
+		{"/search", "/search?query=queen", 200},
+		{"/search", "/search?query=que&format=strings", 200},
+		{"/markerHandler", "/markerHandler?artistID=1", 200},
+		{"/data-quality", "/data-quality", 200},
+		{"/api/v1/artists", "/api/v1/artists?page_size=2", 200},
+		{"/api/v1/artists", "/api/v1/artists?near=osaka-japan&country=UK", 200},
+		{"/api/v1/artists", "/api/v1/artists?page=0", 400},
+		{"/api/v1/artists/{id}", "/api/v1/artists/2", 200},
+		{"/api/v1/artists/{id}", "/api/v1/artists/two", 400},
+		{"/api/v1/artists/{id}", "/api/v1/artists/99", 404},
+		{"/api/v1/artists/{id}/concerts", "/api/v1/artists/1/concerts", 200},
+		{"/api/v1/artists/{id}/concerts", "/api/v1/artists/two/concerts", 400},
+		{"/api/v1/artists/{id}/concerts", "/api/v1/artists/99/concerts", 404},
+		{"/api/v1/locations", "/api/v1/locations", 200},
+		{"/api/v1/locations", "/api/v1/locations?page_size=1000", 400},
+		{"/api/v1/locations/{key}/artists", "/api/v1/locations/london-uk/artists", 200},
+		{"/api/v1/locations/{key}/artists", "/api/v1/locations/london/artists", 400},
+		{"/api/v1/locations/{key}/artists", "/api/v1/locations/paris-france/artists", 404},
+	}
+
+	paths := document["paths"].(map[string]any)
+	covered := map[string]bool{}
+	for _, test := range tests {
+		operation, ok := paths[test.path].(map[string]any)["get"].(map[string]any)
+		if !ok {
+			t.Errorf("%s isn't documented", test.path)
+			continue
+		}
+		response, ok := operation["responses"].(map[string]any)[fmt.Sprint(test.status)].(map[string]any)
+		if !ok {
+			t.Errorf("%s: status %d isn't documented", test.path, test.status)
+			continue
+		}
+		covered[test.path+" "+fmt.Sprint(test.status)] = true
+
+		recorder := get(t, mux, test.target)
+		if recorder.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.target, recorder.Code, test.status)
+			continue
+		}
+
+		content := response["content"].(map[string]any)
+		contentType := recorder.Header().Get("Content-Type")
+		media, ok := content[contentType].(map[string]any)
+		if !ok {
+			t.Errorf("%s: Content-Type %q isn't documented", test.target, contentType)
+			continue
+		}
+		schema := media["schema"].(map[string]any)
+
+		bodies := []any{}
+		if contentType == "text/event-stream" {
+			names := []string{}
+			for _, event := range parseEvents(recorder.Body.String()) {
+				names = append(names, event.name)
+				var body any
+				if err := json.Unmarshal([]byte(event.data), &body); err != nil {
+					t.Errorf("%s: event %q: %v", test.target, event.data, err)
+				}
+				bodies = append(bodies, body)
+			}
+			if !slices.Contains(names, "") || !slices.Contains(names, "unresolved") {
+				t.Errorf("%s: events %q, want markers and unresolved ones", test.target, names)
+			}
+		} else {
+			bodies = append(bodies, decode[any](t, recorder))
+		}
+		for _, body := range bodies {
+			for _, err := range schemaErrors(document, schema, body, test.target) {
+				t.Error(err)
+			}
+		}
+	}
+
+	for path, item := range paths {
+		for status := range item.(map[string]any)["get"].(map[string]any)["responses"].(map[string]any) {
+			if !covered[path+" "+status] {
+				t.Errorf("%s: status %s isn't checked", path, status)
+			}
+		}
+	}
+}
+
+// every documented parameter is taken with a valid value, bad numbers are turned away
+func TestOpenAPIParameters(t *testing.T) {
+	useFixture(t, testFixture())
+	document := openAPIDocument(t)
+	mux := documentedMux()
+
+	for path, item := range document["paths"].(map[string]any) {
+		operation := item.(map[string]any)["get"].(map[string]any)
+		parameters, _ := operation["parameters"].([]any)
+
+		target := path
+		query := url.Values{}
+		for _, parameter := range parameters {
+			parameter := parameter.(map[string]any)
+			name := parameter["name"].(string)
+			if parameter["in"] == "path" {
+				target = strings.ReplaceAll(target, "{"+name+"}", exampleValue(parameter))
+			} else {
+				query.Set(name, exampleValue(parameter))
+			}
+		}
+		if path == "/markerHandler" {
+			continue //streams, and doesn't validate anything but the artist ID
+		}
+
+		for _, parameter := range parameters {
+			parameter := parameter.(map[string]any)
+			name := parameter["name"].(string)
+			if parameter["in"] != "query" {
+				continue
+			}
+
+			single := url.Values{name: {query.Get(name)}}
+			if recorder := get(t, mux, target+"?"+single.Encode()); recorder.Code != 200 {
+				t.Errorf("%s with %s: status %d %s", path, single.Encode(), recorder.Code, recorder.Body.String())
+			}
+
+			//a number that isn't one is a bad request wherever the operation documents bad requests
+			schema := parameter["schema"].(map[string]any)
+			if items, ok := schema["items"].(map[string]any); ok {
+				schema = items
+			}
+			_, documents400 := operation["responses"].(map[string]any)["400"]
+			if documents400 && (schema["type"] == "integer" || schema["type"] == "number") {
+				//along with the others, radius_km is only read with near
+				bad := url.Values{}
+				for key, values := range query {
+					bad[key] = values
+				}
+				bad.Set(name, "lots")
+				if recorder := get(t, mux, target+"?"+bad.Encode()); recorder.Code != 400 {
+					t.Errorf("%s with %s: status %d, want 400", path, bad.Encode(), recorder.Code)
+				}
+			}
+		}
+
+		//all of them at once
+		if recorder := get(t, mux, target+"?"+query.Encode()); recorder.Code != 200 {
+			t.Errorf("%s?%s: status %d %s", path, query.Encode(), recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// one page of a listing
+type apiPage[T any] struct {
+	Total      int      `json:"total"`
+	Page       int      `json:"page"`
+	PageSize   int      `json:"pageSize"`
+	TotalPages int      `json:"totalPages"`
+	Next       string   `json:"next,omitempty"` // link to the next page with the same filters, missing on the last page
+	Prev       string   `json:"prev,omitempty"` // link to the previous page with the same filters, missing on the first page
+	Items      []T      `json:"items"`
+	Warnings   []string `json:"warnings,omitempty"` // what the filters couldn't check, like concert locations that aren't geocoded yet
+}
+
+// reads page and page_size out of the query
+func parsePagination(request *http.Request) (int, int, error) {
+	page, pageSize := 1, defaultPageSize
+
+	if temp := request.FormValue("page"); temp != "" {
+		value, err := strconv.Atoi(temp)
+		if err != nil || value < 1 {
+			return 0, 0, fmt.Errorf("page must be a number from 1 up, got %q", temp)
+		}
+		page = value
+	}
+
+	if temp := request.FormValue("page_size"); temp != "" {
+		value, err := strconv.Atoi(temp)
+		if err != nil || value < 1 || value > maxPageSize {
+			return 0, 0, fmt.Errorf("page_size must be a number from 1 to %d, got %q", maxPageSize, temp)
+		}
+		pageSize = value
+	}
+
+	return page, pageSize, nil
+}
+
+// cuts one page out of a listing, the links lead to path with the given query values and the page changed
+func paginate[T any](items []T, page, pageSize int, path string, values url.Values) apiPage[T] {
+	//a page past the end is empty, checked before multiplying so a huge page number can't overflow
+	start := len(items)
+	if page-1 <= len(items)/pageSize {
+		start = min((page-1)*pageSize, len(items))
+	}
+	end := min(start+pageSize, len(items))
+	result := apiPage[T]{
+		Total:      len(items),
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: totalPages(len(items), pageSize),
+		Items:      slices.Clone(items[start:end]),
+	}
+	result.Next, result.Prev = pageLinks(path, values, page, pageSize, len(items))
+	return result
+}
+
+// a listing always has at least one page, even if it's empty
+func totalPages(total, pageSize int) int {
+	return max(1, (total+pageSize-1)/pageSize)
+}
+
+// links to the next and previous pages, "" if there isn't one.
+// A page past the end links back to the last page
+func pageLinks(path string, values url.Values, page, pageSize, total int) (string, string) {
+	link := func(page int) string {
+		query := url.Values{}
+		for key, value := range values {
+			query[key] = slices.Clone(value)
+		}
+		query.Set("page", strconv.Itoa(page))
+		if pageSize != defaultPageSize {
+			query.Set("page_size", strconv.Itoa(pageSize))
+		}
+		return path + "?" + query.Encode()
+	}
+
+	lastPage := totalPages(total, pageSize)
+	next, prev := "", ""
+	if page < lastPage {
+		next = link(page + 1)
+	}
+	if page > 1 {
+		prev = link(min(page-1, lastPage))
+	}
+	return next, prev
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// kinds of data quality issues
+const (
+	issueMissingArtist     = "missing artist"          // relation, locations or dates data for an ID with no artist
+	issueMissingRelation   = "missing relation"        // artist with no relation data
+	issueMissingLocations  = "missing locations"       // artist with no locations data
+	issueMissingDates      = "missing dates"           // artist with no dates data
+	issueDuplicateID       = "duplicate id"            // the same ID appears twice in one endpoint
+	issueUnknownLocation   = "unknown location"        // location in the relation data but not in the locations data
+	issueLocationNoDates   = "location without dates"  // location in the locations data but not in the relation data
+	issueUnknownDate       = "unknown date"            // date in the relation data but not in the dates data
+	issueDateNoLocation    = "date without location"   // date in the dates data that isn't in the relation data under any location
+	issueLocationGroupSize = "location group mismatch" // the "*" marked dates don't line up with the number of locations
+)
+
+// a single problem found while cross-checking the data
+type QualityIssue struct {
+	ArtistID int    `json:"artistId"`
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail"`
+}
+
+// result of cross-checking the relation data with the locations and dates data
+type QualityReport struct {
+	CheckedAt time.Time      `json:"checkedAt"`
+	Counts    map[string]int `json:"counts"`
+	Issues    []QualityIssue `json:"issues"`
+}
+
+// handler for the data quality report, responds with JSON
+func DataQualityHandler(writer http.ResponseWriter, request *http.Request) {
+	jsonData, err := json.MarshalIndent(Data().Quality, "", "  ")
+	if err != nil {
+		http.Error(writer, "Failed to generate report", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	writer.Write(jsonData)
+}
+
+// cross-checks the relation data against the locations and dates data. Locations and dates are only
+// checked if the source provided them at all. IDs are checked against source, the data as it was loaded,
+// since the dataset leaves out relation data with no artist
+func checkDataQuality(data *Dataset, source SourceData) QualityReport {
+	report := QualityReport{
+		CheckedAt: time.Now(),
+		Counts: map[string]int{
+			"artists":   len(data.Artists),
+			"relations": len(data.Relations),
+			"locations": len(data.Locations),
+			"dates":     len(data.Dates),
+		},
+		Issues: []QualityIssue{},
+	}
+
+	addIssue := func(artistID int, kind, detail string, args ...any) {
+		report.Issues = append(report.Issues, QualityIssue{ArtistID: artistID, Kind: kind, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	haveLocations := len(data.Locations) > 0
+	haveDates := len(data.Dates) > 0
+
+	//duplicate IDs as loaded, validation keeps only the first artist and the lookup maps only the last of the rest
+	checkDuplicates := func(endpoint string, ids []int) {
+		seen := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			if seen[id] {
+				addIssue(id, issueDuplicateID, "ID %d appears more than once in %s", id, endpoint)
+			}
+			seen[id] = true
+		}
+	}
+	checkDuplicates("artists", mapSlice(source.Artists, func(a Artist) int { return a.ID }))
+	checkDuplicates("relation", mapSlice(source.Relations, func(r Relation) int { return r.ID }))
+	checkDuplicates("locations", mapSlice(source.Locations, func(l Location) int { return l.ID }))
+	checkDuplicates("dates", mapSlice(source.Dates, func(d Date) int { return d.ID }))
+
+	//IDs that don't match up between the endpoints
+	artistIDs := map[int]bool{}
+	for _, artist := range source.Artists {
+		artistIDs[artist.ID] = true
+	}
+	checkArtists := func(endpoint string, ids []int) {
+		for _, id := range ids {
+			if !artistIDs[id] {
+				addIssue(id, issueMissingArtist, "%s data for ID %d has no artist", endpoint, id)
+			}
+		}
+	}
+	checkArtists("relation", mapSlice(source.Relations, func(r Relation) int { return r.ID }))
+	checkArtists("locations", mapSlice(source.Locations, func(l Location) int { return l.ID }))
+	checkArtists("dates", mapSlice(source.Dates, func(d Date) int { return d.ID }))
+
+	for _, artist := range data.Artists {
+		relation, ok := data.ArtistRelationMap[artist.ID]
+		if !ok {
+			addIssue(artist.ID, issueMissingRelation, "%s has no relation data", artist.Name)
+			continue
+		}
+
+		if haveLocations {
+			location, ok := data.LocationMap[artist.ID]
+			if !ok {
+				addIssue(artist.ID, issueMissingLocations, "%s has no locations data", artist.Name)
+			} else {
+				for _, key := range sortedKeys(relation.DatesLocations) {
+					if !slices.Contains(location.Locations, key) {
+						addIssue(artist.ID, issueUnknownLocation, "%s: %q is in the relation data but not in the locations data", artist.Name, key)
+					}
+				}
+				for _, key := range location.Locations {
+					if _, ok := relation.DatesLocations[key]; !ok {
+						addIssue(artist.ID, issueLocationNoDates, "%s: %q is in the locations data but has no dates in the relation data", artist.Name, key)
+					}
+				}
+			}
+		}
+
+		if haveDates {
+			date, ok := data.DateMap[artist.ID]
+			if !ok {
+				addIssue(artist.ID, issueMissingDates, "%s has no dates data", artist.Name)
+				continue
+			}
+
+			relationDates := map[string]bool{}
+			for _, dates := range relation.DatesLocations {
+				for _, d := range dates {
+					relationDates[d] = true
+				}
+			}
+
+			datesDates := map[string]bool{}
+			groups := 0
+			for _, d := range date.Dates {
+				if strings.HasPrefix(d, "*") {
+					groups++
+				}
+				datesDates[strings.TrimPrefix(d, "*")] = true
+			}
+
+			for _, d := range sortedKeys(datesDates) {
+				if !relationDates[d] {
+					addIssue(artist.ID, issueDateNoLocation, "%s: %s is in the dates data but not at any location in the relation data", artist.Name, d)
+				}
+			}
+			for _, d := range sortedKeys(relationDates) {
+				if !datesDates[d] {
+					addIssue(artist.ID, issueUnknownDate, "%s: %s is in the relation data but not in the dates data", artist.Name, d)
+				}
+			}
+
+			if location, ok := data.LocationMap[artist.ID]; ok && groups != len(location.Locations) {
+				addIssue(artist.ID, issueLocationGroupSize, "%s: dates data marks %d location groups but there are %d locations", artist.Name, groups, len(location.Locations))
+			}
+		}
+	}
+
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].ArtistID < report.Issues[j].ArtistID
+	})
+
+	return report
+}
+
+func mapSlice[T any, R any](items []T, f func(T) R) []R {
+	result := make([]R, 0, len(items))
+	for _, item := range items {
+		result = append(result, f(item))
+	}
+	return result
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
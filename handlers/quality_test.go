@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// two artists whose data lines up across all four endpoints
+func consistentSource() SourceData {
+	return SourceData{
+		Artists: []Artist{validArtist(1, "Queen"), validArtist(2, "Motörhead")},
+		Relations: []Relation{
+			{ID: 1, DatesLocations: map[string][]string{"london-uk": {"10-11-2019"}, "osaka-japan": {"28-01-2020"}}},
+			{ID: 2, DatesLocations: map[string][]string{"berlin-germany": {"05-12-2019", "06-12-2019"}}},
+		},
+		Locations: []Location{
+			{ID: 1, Locations: []string{"london-uk", "osaka-japan"}},
+			{ID: 2, Locations: []string{"berlin-germany"}},
+		},
+		Dates: []Date{
+			{ID: 1, Dates: []string{"*10-11-2019", "*28-01-2020"}},
+			{ID: 2, Dates: []string{"*05-12-2019", "06-12-2019"}},
+		},
+	}
+}
+
+func TestCheckDataQuality(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(source *SourceData)
+		issues []string // "artist ID: kind", in the order of the report
+	}{
+		{
+			name:   "consistent data",
+			change: func(source *SourceData) {},
+		},
+		{
+			name:   "date with no matching location",
+			change: func(source *SourceData) { source.Dates[0].Dates = append(source.Dates[0].Dates, "01-01-2021") },
+			issues: []string{"1: " + issueDateNoLocation},
+		},
+		{
+			name: "relation date missing from the dates",
+			change: func(source *SourceData) {
+				source.Relations[0].DatesLocations["london-uk"] = append(source.Relations[0].DatesLocations["london-uk"], "11-11-2019")
+			},
+			issues: []string{"1: " + issueUnknownDate},
+		},
+		{
+			name: "relation for an artist that doesn't exist",
+			change: func(source *SourceData) {
+				source.Relations = append(source.Relations, Relation{ID: 7, DatesLocations: map[string][]string{"lima-peru": {"01-01-2020"}}})
+			},
+			issues: []string{"7: " + issueMissingArtist},
+		},
+		{
+			name: "IDs that don't match across the endpoints",
+			change: func(source *SourceData) {
+				source.Artists = append(source.Artists, validArtist(3, "Sigur Rós"))
+				source.Locations[1].ID = 8
+				source.Dates[1].ID = 9
+			},
+			issues: []string{
+				"2: " + issueMissingLocations, "2: " + issueMissingDates, "3: " + issueMissingRelation,
+				"8: " + issueMissingArtist, "9: " + issueMissingArtist,
+			},
+		},
+		{
+			name: "duplicate IDs",
+			change: func(source *SourceData) {
+				source.Artists = append(source.Artists, validArtist(1, "Impostor"))
+				source.Relations = append(source.Relations, source.Relations[0])
+				source.Locations = append(source.Locations, source.Locations[1])
+				source.Dates = append(source.Dates, source.Dates[1])
+			},
+			issues: []string{"1: " + issueDuplicateID, "1: " + issueDuplicateID, "2: " + issueDuplicateID, "2: " + issueDuplicateID},
+		},
+		{
+			name:   "locations that don't match the relation data",
+			change: func(source *SourceData) { source.Locations[0].Locations = []string{"london-uk", "paris-france"} },
+			issues: []string{"1: " + issueUnknownLocation, "1: " + issueLocationNoDates},
+		},
+		{
+			name:   "location groups that don't line up",
+			change: func(source *SourceData) { source.Dates[1].Dates = []string{"05-12-2019", "06-12-2019"} },
+			issues: []string{"2: " + issueLocationGroupSize},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := consistentSource()
+			test.change(&source)
+			report := NewDataset(source, time.Now(), false).Quality
+
+			issues := []string{}
+			for _, issue := range report.Issues {
+				issues = append(issues, fmt.Sprintf("%d: %s", issue.ArtistID, issue.Kind))
+				if issue.Detail == "" {
+					t.Errorf("%+v has no detail", issue)
+				}
+			}
+			if !slices.Equal(issues, test.issues) && (len(issues) != 0 || len(test.issues) != 0) {
+				t.Errorf("issues %q, want %q\n%+v", issues, test.issues, report.Issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,466 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Search bar query language, like: member:freddie country:japan year:1970..1980 -name:queen
+//
+//	query   = or
+//	or      = and { "OR" and }
+//	and     = not { ["AND"] not }        terms next to each other are ANDed
+//	not     = ("NOT" | "-") not | primary
+//	primary = "(" or ")" | [field ":"] (word | "quoted phrase" | from..to)
+//
+// Plain words search every field the way the search bar always did, "queen" and "Freddie Mercury - member" still work.
+
+// fields a term can be scoped to, and what they search
+var queryFields = map[string]string{
+	"name":      "artist or band name",
+	"member":    "member name",
+	"location":  "concert location",
+	"city":      "concert city",
+	"country":   "concert country",
+	"continent": "concert continent",
+	"year":      "creation year, a year or a range like 1970..1980",
+	"album":     "first album year, a year or a range like 1970..1980",
+}
+
+// the suggestion kind each field searches through the search index
+var fieldKinds = map[string]string{
+	"name":     kindArtist,
+	"member":   kindMember,
+	"location": kindLocation,
+}
+
+// a query that couldn't be parsed, with where it went wrong
+type QueryError struct {
+	Position int // in characters, from 0
+	Message  string
+}
+
+func (err *QueryError) Error() string {
+	return fmt.Sprintf("bad search at character %d: %s", err.Position+1, err.Message)
+}
+
+// a parsed query, evaluates to the scores of the matching artists by artist ID
+type queryNode interface {
+	eval(data *Dataset) map[int]int
+	String() string
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ child queryNode }
+
+// searches text in a field, or in every field if field and kind are ""
+type termNode struct {
+	field string // what the user scoped the term to
+	kind  string // the suggestion kind searched, for fields that go through the search index
+	text  string
+	exact bool // no typos, for suggestions picked from the list
+}
+
+// a year or a range of years, 0 for an open end
+type rangeNode struct {
+	field    string
+	from, to int
+}
+
+func (node andNode) String() string {
+	return "AND(" + node.left.String() + ", " + node.right.String() + ")"
+}
+func (node orNode) String() string {
+	return "OR(" + node.left.String() + ", " + node.right.String() + ")"
+}
+func (node notNode) String() string { return "NOT(" + node.child.String() + ")" }
+
+func (node termNode) String() string {
+	text := strconv.Quote(node.text)
+	if node.field != "" {
+		text = node.field + ":" + text
+	} else if node.kind != "" {
+		text = "[" + node.kind + "]:" + text
+	}
+	if node.exact {
+		text += "!"
+	}
+	return text
+}
+
+func (node rangeNode) String() string {
+	text := node.field + ":"
+	if node.from != 0 {
+		text += strconv.Itoa(node.from)
+	}
+	text += ".."
+	if node.to != 0 {
+		text += strconv.Itoa(node.to)
+	}
+	return text
+}
+
+// both sides have to match, the scores add up
+func (node andNode) eval(data *Dataset) map[int]int {
+	left, right := node.left.eval(data), node.right.eval(data)
+	scores := map[int]int{}
+	for id, score := range left {
+		if rightScore, ok := right[id]; ok {
+			scores[id] = score + rightScore
+		}
+	}
+	return scores
+}
+
+// either side has to match, the better score counts
+func (node orNode) eval(data *Dataset) map[int]int {
+	scores := node.left.eval(data)
+	for id, score := range node.right.eval(data) {
+		if leftScore, ok := scores[id]; !ok || score > leftScore {
+			scores[id] = score
+		}
+	}
+	return scores
+}
+
+// every artist that doesn't match, nothing to score them by
+func (node notNode) eval(data *Dataset) map[int]int {
+	excluded := node.child.eval(data)
+	scores := map[int]int{}
+	for _, artist := range data.Artists {
+		if _, ok := excluded[artist.ID]; !ok {
+			scores[artist.ID] = 0
+		}
+	}
+	return scores
+}
+
+func (node termNode) eval(data *Dataset) map[int]int {
+	switch node.field {
+	case "city", "country", "continent":
+		scores := map[int]int{}
+		for _, artist := range data.Artists {
+			for _, concert := range data.Concerts.ByArtist[artist.ID] {
+				value := concert.City
+				switch node.field {
+				case "country":
+					value = concert.Country
+				case "continent":
+					value = concert.Continent()
+				}
+				//matches the start of the name or of one of its words
+				if matchRange(value, node.text)[1] > 0 {
+					scores[artist.ID] = scoreLocation + scoreExactBonus
+					break
+				}
+			}
+		}
+		return scores
+	}
+	return scoreArtists(data.Search.search(node.text, node.kind, !node.exact))
+}
+
+func (node rangeNode) eval(data *Dataset) map[int]int {
+	scores := map[int]int{}
+	for _, artist := range data.Artists {
+		year := artist.CreationDate
+		if node.field == "album" {
+			year = artist.FirstAlbumDate.Year()
+		}
+		if (node.from == 0 || year >= node.from) && (node.to == 0 || year <= node.to) {
+			scores[artist.ID] = scoreDate + scoreExactBonus
+		}
+	}
+	return scores
+}
+
+type queryTokenKind int
+
+const (
+	tokenWord queryTokenKind = iota
+	tokenPhrase
+	tokenLeftParen
+	tokenRightParen
+	tokenNot // "-" right before a term
+	tokenEnd
+)
+
+type queryToken struct {
+	kind     queryTokenKind
+	text     string // the word or phrase, without the field
+	field    string // "" if the term isn't scoped to a field
+	position int
+}
+
+// splits a query into tokens
+func tokenizeQuery(query string) ([]queryToken, error) {
+	runes := []rune(query)
+	tokens := []queryToken{}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		//a dash on its own, like in "Osaka - Japan", is just a separator
+		case r == '-' && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])):
+			i++
+
+		case r == '-':
+			tokens = append(tokens, queryToken{kind: tokenNot, position: i})
+			i++
+
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenLeftParen, position: i})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenRightParen, position: i})
+			i++
+
+		case r == '"':
+			phrase, end, err := readPhrase(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokenPhrase, text: phrase, position: i})
+			i = end
+
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`()"`, runes[i]) {
+				i++
+			}
+			token := queryToken{kind: tokenWord, text: string(runes[start:i]), position: start}
+
+			field, value, found := strings.Cut(token.text, ":")
+			if found && isFieldName(field) {
+				field = strings.ToLower(field)
+				if _, ok := queryFields[field]; !ok {
+					return nil, &QueryError{Position: start, Message: fmt.Sprintf("unknown field %q, the fields are %s", field, fieldNames())}
+				}
+				token.field, token.text = field, value
+
+				//member:"freddie mercury"
+				if value == "" && i < len(runes) && runes[i] == '"' {
+					phrase, end, err := readPhrase(runes, i)
+					if err != nil {
+						return nil, err
+					}
+					token.kind, token.text = tokenPhrase, phrase
+					i = end
+				}
+				if strings.TrimSpace(token.text) == "" {
+					return nil, &QueryError{Position: start, Message: fmt.Sprintf("nothing to search for after %q", field+":")}
+				}
+			}
+			tokens = append(tokens, token)
+		}
+	}
+
+	return append(tokens, queryToken{kind: tokenEnd, position: len(runes)}), nil
+}
+
+// reads a quoted phrase starting at the opening quote, returns it and where it ends
+func readPhrase(runes []rune, start int) (string, int, error) {
+	for end := start + 1; end < len(runes); end++ {
+		if runes[end] == '"' {
+			phrase := strings.TrimSpace(string(runes[start+1 : end]))
+			if phrase == "" {
+				return "", 0, &QueryError{Position: start, Message: "empty quotes"}
+			}
+			return phrase, end + 1, nil
+		}
+	}
+	return "", 0, &QueryError{Position: start, Message: "quote is never closed"}
+}
+
+// field names are plain letters, so something like "12:30" stays a word
+func isFieldName(text string) bool {
+	if text == "" {
+		return false
+	}
+	for _, r := range text {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func fieldNames() string {
+	return strings.Join(sortedKeys(queryFields), ", ")
+}
+
+// the fields with what they search, for the API description
+func queryFieldsDescription() string {
+	descriptions := []string{}
+	for _, field := range sortedKeys(queryFields) {
+		descriptions = append(descriptions, field+" ("+queryFields[field]+")")
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+type queryParser struct {
+	tokens  []queryToken
+	current int
+}
+
+func (parser *queryParser) peek() queryToken {
+	return parser.tokens[parser.current]
+}
+
+func (parser *queryParser) next() queryToken {
+	token := parser.tokens[parser.current]
+	if token.kind != tokenEnd {
+		parser.current++
+	}
+	return token
+}
+
+// true if the next token is the operator, operators are only recognized in capitals so "and" can still be searched for
+func (parser *queryParser) isOperator(operator string) bool {
+	token := parser.peek()
+	return token.kind == tokenWord && token.field == "" && token.text == operator
+}
+
+func (parser *queryParser) parseOr() (queryNode, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.isOperator("OR") {
+		parser.next()
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (parser *queryParser) parseAnd() (queryNode, error) {
+	left, err := parser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if parser.isOperator("AND") {
+			parser.next()
+		} else if parser.isOperator("OR") || parser.peek().kind == tokenEnd || parser.peek().kind == tokenRightParen {
+			return left, nil
+		}
+		right, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (parser *queryParser) parseNot() (queryNode, error) {
+	if parser.isOperator("NOT") || parser.peek().kind == tokenNot {
+		parser.next()
+		child, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child}, nil
+	}
+	return parser.parsePrimary()
+}
+
+func (parser *queryParser) parsePrimary() (queryNode, error) {
+	token := parser.next()
+	switch token.kind {
+	case tokenLeftParen:
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := parser.next(); closing.kind != tokenRightParen {
+			return nil, &QueryError{Position: token.position, Message: "bracket is never closed"}
+		}
+		return node, nil
+
+	case tokenRightParen:
+		return nil, &QueryError{Position: token.position, Message: "closing bracket without an opening one"}
+
+	case tokenEnd:
+		return nil, &QueryError{Position: token.position, Message: "the search ends where a term was expected"}
+
+	case tokenWord:
+		if token.field == "" && (token.text == "AND" || token.text == "OR" || token.text == "NOT") {
+			return nil, &QueryError{Position: token.position, Message: fmt.Sprintf("%s needs a term before and after it", token.text)}
+		}
+	}
+
+	if token.field == "year" || token.field == "album" {
+		return parseYearRange(token)
+	}
+	return termNode{field: token.field, kind: fieldKinds[token.field], text: token.text}, nil
+}
+
+// parses "1970", "1970..1980", "..1980" or "1970.."
+func parseYearRange(token queryToken) (queryNode, error) {
+	fromText, toText, isRange := strings.Cut(token.text, "..")
+	if !isRange {
+		toText = fromText
+	}
+
+	parseYear := func(text string) (int, error) {
+		if text == "" && isRange {
+			return 0, nil
+		}
+		year, err := strconv.Atoi(text)
+		if err != nil || year < 1 {
+			return 0, &QueryError{Position: token.position, Message: fmt.Sprintf("%s:%s isn't a year or a range of years like 1970..1980", token.field, token.text)}
+		}
+		return year, nil
+	}
+
+	from, err := parseYear(fromText)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseYear(toText)
+	if err != nil {
+		return nil, err
+	}
+	if from == 0 && to == 0 {
+		return nil, &QueryError{Position: token.position, Message: fmt.Sprintf("%s:.. needs at least one year", token.field)}
+	}
+	if from != 0 && to != 0 && from > to {
+		return nil, &QueryError{Position: token.position, Message: fmt.Sprintf("%s:%s starts after it ends", token.field, token.text)}
+	}
+	return rangeNode{field: token.field, from: from, to: to}, nil
+}
+
+// parses the search bar text into a query.
+// A picked suggestion like "Freddie Mercury - member" is taken as it is, an exact search in its field
+func parseQuery(query string) (queryNode, error) {
+	text, kind := splitKindSuffix(query)
+	if kind != "" {
+		return termNode{kind: kind, text: text, exact: true}, nil
+	}
+
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &queryParser{tokens: tokens}
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != tokenEnd {
+		return nil, &QueryError{Position: token.position, Message: "closing bracket without an opening one"}
+	}
+	return node, nil
+}
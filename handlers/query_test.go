@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string // the parsed query as String shows it
+	}{
+		{"queen", `"queen"`},
+
+		//AND binds tighter than OR, NOT tighter than both
+		{"a b OR c", `OR(AND("a", "b"), "c")`},
+		{"a OR b c", `OR("a", AND("b", "c"))`},
+		{"a AND b OR c AND d", `OR(AND("a", "b"), AND("c", "d"))`},
+		{"a OR b OR c", `OR(OR("a", "b"), "c")`},
+		{"NOT a b", `AND(NOT("a"), "b")`},
+		{"NOT a OR b", `OR(NOT("a"), "b")`},
+		{"NOT (a OR b)", `NOT(OR("a", "b"))`},
+		{"a (b OR c)", `AND("a", OR("b", "c"))`},
+		{"and or not", `AND(AND("and", "or"), "not")`}, //operators are only recognized in capitals
+
+		//a dash right before a term negates it, one on its own is a separator
+		{"-name:queen", `NOT(name:"queen")`},
+		{"queen -member:brian", `AND("queen", NOT(member:"brian"))`},
+		{"--a", `NOT(NOT("a"))`},
+		{"osaka - japan", `AND("osaka", "japan")`},
+
+		//fields and quoted phrases
+		{`member:"freddie mercury"`, `member:"freddie mercury"`},
+		{`"freddie mercury" queen`, `AND("freddie mercury", "queen")`},
+		{`" spaced out "`, `"spaced out"`},
+		{"MEMBER:Freddie", `member:"Freddie"`},
+		{"12:30", `"12:30"`},
+
+		//years and ranges of years
+		{"year:1975", "year:1975..1975"},
+		{"year:1970..1980", "year:1970..1980"},
+		{"album:..1980", "album:..1980"},
+		{"year:1970..", "year:1970.."},
+
+		//a picked suggestion is an exact search of its kind
+		{"Freddie Mercury - member", `[member]:"Freddie Mercury"!`},
+	}
+
+	for _, test := range tests {
+		node, err := parseQuery(test.query)
+		if err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+		if got := node.String(); got != test.want {
+			t.Errorf("%q parsed as %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int    // from 0
+		message  string // part of the message
+	}{
+		{`"open`, 0, "quote is never closed"},
+		{`queen ""`, 6, "empty quotes"},
+		{"shoe:9", 0, `unknown field "shoe"`},
+		{"name:", 0, `nothing to search for after "name:"`},
+		{"(a OR b", 0, "bracket is never closed"},
+		{"a)", 1, "closing bracket without an opening one"},
+		{"a OR", 4, "the search ends where a term was expected"},
+		{"OR a", 0, "OR needs a term before and after it"},
+		{"a AND AND b", 6, "AND needs a term before and after it"},
+		{"NOT", 3, "the search ends where a term was expected"},
+		{"year:abc", 0, "year:abc isn't a year"},
+		{"queen year:..", 6, "year:.. needs at least one year"},
+		{"album:1990..1980", 0, "album:1990..1980 starts after it ends"},
+		{"mötley year:x", 7, "year:x isn't a year"}, //in characters, not bytes
+	}
+
+	for _, test := range tests {
+		_, err := parseQuery(test.query)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("%q: %v, want a QueryError", test.query, err)
+			continue
+		}
+		if queryErr.Position != test.position || !strings.Contains(queryErr.Message, test.message) {
+			t.Errorf("%q: at %d %q, want at %d %q", test.query, queryErr.Position, queryErr.Message, test.position, test.message)
+		}
+	}
+
+	//the text counts characters from 1, the way the user reads the query
+	_, err := parseQuery(`queen ""`)
+	if err == nil || err.Error() != "bad search at character 7: empty quotes" {
+		t.Errorf("error text %v", err)
+	}
+}
+
+// parsed queries find the artists they say they do
+func TestQueryEval(t *testing.T) {
+	data := useFixture(t, testFixture())
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"-name:queen", []string{"Motörhead", "Sigur Rós"}},
+		{"country:uk OR country:germany", []string{"Motörhead", "Queen", "Sigur Rós"}},
+		{"country:uk -member:brian", []string{"Sigur Rós"}},
+		{"NOT (country:uk OR country:germany)", []string{}},
+		{`member:"brian may"`, []string{"Queen"}},
+		{"year:1970..1980", []string{"Motörhead", "Queen"}},
+		{"album:1990..", []string{"Sigur Rós"}},
+		{"city:osaka OR continent:south", []string{"Motörhead", "Queen"}},
+	}
+
+	for _, test := range tests {
+		query, err := parseSearch(test.query)
+		if err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+		artists, _ := searchFilter(query, data.Artists, data)
+		names := artistNames(artists)
+		slices.Sort(names)
+		if !slices.Equal(names, test.want) {
+			t.Errorf("%q found %q, want %q", test.query, names, test.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSON API under /api/v1, for the frontend to build against instead of the HTML pages
+
+// body of every error the API responds with
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// a concert as the API shows it
+type apiConcert struct {
+	ArtistID  int    `json:"artistId"`
+	Date      string `json:"date"` // YYYY-MM-DD
+	City      string `json:"city"`
+	Country   string `json:"country"`
+	Location  string `json:"location"` // location key, "los_angeles-usa"
+	Latitude  string `json:"lat,omitempty"`
+	Longitude string `json:"lon,omitempty"`
+}
+
+// a concert location as the API shows it
+type apiConcertLocation struct {
+	Location     string `json:"location"` // location key, "los_angeles-usa"
+	City         string `json:"city"`
+	Country      string `json:"country"`
+	ArtistCount  int    `json:"artistCount"`
+	ConcertCount int    `json:"concertCount"`
+}
+
+func sendJSON(writer http.ResponseWriter, status int, value any) {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		http.Error(writer, "Failed to generate response", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(jsonData)
+}
+
+// sends a listing, one with warnings isn't cached since they can go away on the next request
+func sendWarnedJSON(writer http.ResponseWriter, response apiPage[Artist]) {
+	if len(response.Warnings) > 0 {
+		writer.Header().Set("Cache-Control", "no-store")
+	}
+	sendJSON(writer, http.StatusOK, response)
+}
+
+func sendJSONError(writer http.ResponseWriter, status int, message string) {
+	sendJSON(writer, status, apiError{Error: apiErrorBody{Status: status, Message: message}})
+}
+
+// parses filters and pagination, responds with an error and returns false if any of them are bad
+func parseListingRequest(writer http.ResponseWriter, request *http.Request, data *Dataset) (FilterT, int, int, bool) {
+	if err := request.ParseForm(); err != nil {
+		sendJSONError(writer, http.StatusBadRequest, "bad query")
+		return FilterT{}, 0, 0, false
+	}
+
+	filter, err := parseFilter(request, data)
+	if err != nil {
+		sendJSONError(writer, http.StatusBadRequest, err.Error())
+		return FilterT{}, 0, 0, false
+	}
+
+	page, pageSize, err := parsePagination(request)
+	if err != nil {
+		sendJSONError(writer, http.StatusBadRequest, err.Error())
+		return FilterT{}, 0, 0, false
+	}
+
+	return filter, page, pageSize, true
+}
+
+// finds the artist of the {id} in the path, responds with an error and returns false if there's no such artist
+func artistFromPath(writer http.ResponseWriter, request *http.Request, data *Dataset) (Artist, bool) {
+	id, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil {
+		sendJSONError(writer, http.StatusBadRequest, "artist ID must be a number")
+		return Artist{}, false
+	}
+
+	artist, ok := data.ArtistMap[id]
+	if !ok {
+		sendJSONError(writer, http.StatusNotFound, "artist not found")
+		return Artist{}, false
+	}
+	return artist, true
+}
+
+// concerts as the API shows them, with the coordinates their locations have now
+func toAPIConcerts(concerts []Concert) []apiConcert {
+	result := make([]apiConcert, 0, len(concerts))
+	for _, concert := range concerts {
+		marker, _ := concert.Marker()
+		result = append(result, apiConcert{
+			ArtistID:  concert.ArtistID,
+			Date:      concert.Date.Format("2006-01-02"),
+			City:      concert.City,
+			Country:   concert.Country,
+			Location:  concert.Location,
+			Latitude:  marker.Latitude,
+			Longitude: marker.Longitude,
+		})
+	}
+	return result
+}
+
+// GET /api/v1/artists, artists matching the same filters as the main page
+func APIArtistsHandler(writer http.ResponseWriter, request *http.Request) {
+	data := Data()
+
+	filter, page, pageSize, ok := parseListingRequest(writer, request, data)
+	if !ok {
+		return
+	}
+
+	query, err := parseSearch(filter.SearchBar)
+	if err != nil {
+		sendJSONError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	artists, _ := searchFilter(query, filterArtists(filter, data), data)
+	sortArtists(artists, filter, data, time.Now())
+	filter.queueGeocoding(data)
+
+	response := paginate(artists, page, pageSize, request.URL.EscapedPath(), filter.values())
+	response.Warnings = filter.radiusNotes(data)
+	sendWarnedJSON(writer, response)
+}
+
+// GET /api/v1/artists/{id}
+func APIArtistHandler(writer http.ResponseWriter, request *http.Request) {
+	artist, ok := artistFromPath(writer, request, Data())
+	if !ok {
+		return
+	}
+
+	sendJSON(writer, http.StatusOK, artist)
+}
+
+// GET /api/v1/artists/{id}/concerts, ordered by date
+func APIArtistConcertsHandler(writer http.ResponseWriter, request *http.Request) {
+	data := Data()
+
+	artist, ok := artistFromPath(writer, request, data)
+	if !ok {
+		return
+	}
+
+	sendJSON(writer, http.StatusOK, toAPIConcerts(data.Concerts.ByArtist[artist.ID]))
+}
+
+// GET /api/v1/locations, every concert location ordered by country and city
+func APILocationsHandler(writer http.ResponseWriter, request *http.Request) {
+	data := Data()
+
+	_, page, pageSize, ok := parseListingRequest(writer, request, data)
+	if !ok {
+		return
+	}
+
+	locations := []apiConcertLocation{}
+	locationIndex := map[string]int{}
+	artistsSeen := map[string]map[int]bool{}
+	for _, concert := range data.Concerts.ByDate {
+		i, ok := locationIndex[concert.Location]
+		if !ok {
+			i = len(locations)
+			locationIndex[concert.Location] = i
+			locations = append(locations, apiConcertLocation{Location: concert.Location, City: concert.City, Country: concert.Country})
+			artistsSeen[concert.Location] = map[int]bool{}
+		}
+		locations[i].ConcertCount++
+		if !artistsSeen[concert.Location][concert.ArtistID] {
+			artistsSeen[concert.Location][concert.ArtistID] = true
+			locations[i].ArtistCount++
+		}
+	}
+
+	slices.SortFunc(locations, func(a, b apiConcertLocation) int {
+		if a.Country != b.Country {
+			return strings.Compare(a.Country, b.Country)
+		}
+		return strings.Compare(a.City, b.City)
+	})
+
+	sendJSON(writer, http.StatusOK, paginate(locations, page, pageSize, request.URL.EscapedPath(), url.Values{}))
+}
+
+// GET /api/v1/locations/{key}/artists, artists with a concert at the location, the filters apply here too
+func APILocationArtistsHandler(writer http.ResponseWriter, request *http.Request) {
+	data := Data()
+
+	key, err := normalizeLocationKey(request.PathValue("key"))
+	if err != nil {
+		sendJSONError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, page, pageSize, ok := parseListingRequest(writer, request, data)
+	if !ok {
+		return
+	}
+
+	if _, ok := data.Concerts.ByLocation[key]; !ok {
+		sendJSONError(writer, http.StatusNotFound, "location not found")
+		return
+	}
+
+	query, err := parseSearch(filter.SearchBar)
+	if err != nil {
+		sendJSONError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	matching, _ := searchFilter(query, filterArtists(filter, data), data)
+	artists := []Artist{}
+	for _, artist := range matching {
+		for _, concert := range data.Concerts.ByArtist[artist.ID] {
+			if concert.Location == key {
+				artists = append(artists, artist)
+				break
+			}
+		}
+	}
+
+	sortArtists(artists, filter, data, time.Now())
+	filter.queueGeocoding(data)
+
+	response := paginate(artists, page, pageSize, request.URL.EscapedPath(), filter.values())
+	response.Warnings = filter.radiusNotes(data)
+	sendWarnedJSON(writer, response)
+}
+
+// registers the /api/v1 endpoints and the OpenAPI document on mux
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/artists", APIArtistsHandler)
+	mux.HandleFunc("GET /api/v1/artists/{id}", APIArtistHandler)
+	mux.HandleFunc("GET /api/v1/artists/{id}/concerts", APIArtistConcertsHandler)
+	mux.HandleFunc("GET /api/v1/locations", APILocationsHandler)
+	mux.HandleFunc("GET /api/v1/locations/{key}/artists", APILocationArtistsHandler)
+	mux.HandleFunc("/api/v1/", APINotFoundHandler)
+	mux.HandleFunc("GET /api/openapi.json", OpenAPIHandler)
+}
+
+// anything under /api/v1 that isn't an endpoint
+func APINotFoundHandler(writer http.ResponseWriter, request *http.Request) {
+	sendJSONError(writer, http.StatusNotFound, "no such endpoint")
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"fmt"
+	"groupie/utils"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// how many typos a search word can have, depending on how long it is.
+// The rule with the biggest MinLength that the word reaches applies, words shorter than all of them must match exactly
+type FuzzyRule struct {
+	MinLength   int // in characters
+	MaxDistance int // edits allowed
+}
+
+// set before the server starts, GROUPIE_FUZZY_DISTANCES can change them
+var FuzzyRules = []FuzzyRule{{MinLength: 4, MaxDistance: 1}, {MinLength: 8, MaxDistance: 2}}
+
+// parses rules written as "length:distance" pairs, "4:1,8:2"
+func ParseFuzzyRules(value string) ([]FuzzyRule, error) {
+	rules := []FuzzyRule{}
+	for _, pair := range strings.Split(value, ",") {
+		lengthText, distanceText, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		length, lengthErr := strconv.Atoi(lengthText)
+		distance, distanceErr := strconv.Atoi(distanceText)
+		if !ok || lengthErr != nil || distanceErr != nil || length < 1 || distance < 0 {
+			return nil, fmt.Errorf("bad fuzzy rule %q, expected length:distance like 4:1", pair)
+		}
+		rules = append(rules, FuzzyRule{MinLength: length, MaxDistance: distance})
+	}
+	return rules, nil
+}
+
+// edits allowed for a search word of this length
+func maxDistance(length int) int {
+	distance, bestLength := 0, 0
+	for _, rule := range FuzzyRules {
+		if length >= rule.MinLength && rule.MinLength > bestLength {
+			distance, bestLength = rule.MaxDistance, rule.MinLength
+		}
+	}
+	return distance
+}
+
+// a searchable value, like a member name or a concert location, with all the artists that have it
+type searchEntry struct {
+	Kind      string
+	Label     string
+	ArtistIDs []int
+}
+
+// a word (or a whole value) that leads to an entry
+type indexToken struct {
+	text  string // folded with utils.FoldText
+	entry int
+}
+
+// prefix index over the names, members, dates and locations of a dataset, built once along with the dataset
+type SearchIndex struct {
+	entries     []searchEntry
+	entryLookup map[string]int // by kind and label
+	tokens      []indexToken   // ordered by text, so all the tokens with the same prefix are next to each other
+	trie        *tokenTrie     // over the texts of tokens, for typos
+}
+
+// builds the search index of a dataset, the concerts have to be built already
+func newSearchIndex(data *Dataset) *SearchIndex {
+	index := &SearchIndex{entryLookup: map[string]int{}}
+
+	for _, artist := range data.Artists {
+		index.add(artist.ID, kindArtist, artist.Name, artist.Name)
+
+		for _, member := range artist.Members {
+			index.add(artist.ID, kindMember, member, member)
+		}
+
+		//creation date only matches as a whole
+		index.addWhole(artist.ID, kindCreationDate, fmt.Sprint(artist.CreationDate))
+
+		index.add(artist.ID, kindFirstAlbum, artist.FirstAlbum, artist.FirstAlbum)
+
+		//locations can be written as they come from the data "osaka-japan", as displayed to the user "Osaka - Japan", and with spaces "osaka japan"
+		for _, location := range concertLocations(data.Concerts.ByArtist[artist.ID]) {
+			index.add(artist.ID, kindLocation, utils.FixKey(location), location, utils.FixKey(location), strings.ReplaceAll(location, "-", " "))
+		}
+	}
+
+	sort.Slice(index.tokens, func(i, j int) bool {
+		if index.tokens[i].text == index.tokens[j].text {
+			return index.tokens[i].entry < index.tokens[j].entry
+		}
+		return index.tokens[i].text < index.tokens[j].text
+	})
+	index.tokens = slices.Compact(index.tokens)
+	index.trie = newTokenTrie(index.tokens)
+
+	return index
+}
+
+// returns the entry of a kind and label, making it if it doesn't exist yet, and adds the artist to it.
+// The second return value is false if the entry already existed, so its tokens are already in the index
+func (index *SearchIndex) entryFor(artistID int, kind, label string) (int, bool) {
+	key := kind + "\x00" + label
+	i, ok := index.entryLookup[key]
+	if !ok {
+		i = len(index.entries)
+		index.entryLookup[key] = i
+		index.entries = append(index.entries, searchEntry{Kind: kind, Label: label})
+	}
+	if !slices.Contains(index.entries[i].ArtistIDs, artistID) {
+		index.entries[i].ArtistIDs = append(index.entries[i].ArtistIDs, artistID)
+	}
+	return i, !ok
+}
+
+// adds a value that matches as a whole or by any of its words, in any of the forms it can be written
+func (index *SearchIndex) add(artistID int, kind, label string, forms ...string) {
+	i, isNew := index.entryFor(artistID, kind, label)
+	if !isNew {
+		return
+	}
+	for _, form := range forms {
+		form = utils.FoldText(form)
+		index.tokens = append(index.tokens, indexToken{text: form, entry: i})
+		for _, word := range utils.SplitByWords(form) {
+			index.tokens = append(index.tokens, indexToken{text: word, entry: i})
+		}
+	}
+}
+
+// adds a value that only matches as a whole
+func (index *SearchIndex) addWhole(artistID int, kind, label string) {
+	i, isNew := index.entryFor(artistID, kind, label)
+	if isNew {
+		index.tokens = append(index.tokens, indexToken{text: utils.FoldText(label), entry: i})
+	}
+}
+
+// splits the " - member" style suffix a picked suggestion leaves in the search bar off the query,
+// returns the kind it scopes the search to, or "" for all kinds
+func splitKindSuffix(query string) (string, string) {
+	//trim query in case there's stuff left from suggestion autocomplete
+	query = strings.TrimSpace(query)
+	for kind := range kindOrder {
+		if strings.HasSuffix(query, " - "+kind) {
+			return strings.TrimSpace(strings.TrimSuffix(query, " - "+kind)), kind
+		}
+	}
+	return query, ""
+}
+
+// returns the entries with a token starting with the query, or close to it, with how many edits away they are.
+// Exact prefix matches are 0 away, typos are only looked for if fuzzy is true
+func (index *SearchIndex) lookup(query string, fuzzy bool) map[int]int {
+	query = utils.FoldText(query)
+
+	found := map[int]int{}
+	start := sort.Search(len(index.tokens), func(i int) bool { return index.tokens[i].text >= query })
+	for i := start; i < len(index.tokens) && strings.HasPrefix(index.tokens[i].text, query); i++ {
+		found[index.tokens[i].entry] = 0
+	}
+
+	queryLength := utf8.RuneCountInString(query)
+	limit := maxDistance(queryLength)
+	//a typo in a year is a different year, so numbers only match exactly
+	if !fuzzy || limit == 0 || !strings.ContainsFunc(query, unicode.IsLetter) {
+		return found
+	}
+
+	//only the parts of the trie that can still be close enough are walked
+	index.trie.search([]rune(query), limit, func(start, end, distance int) {
+		for _, token := range index.tokens[start:end] {
+			if known, ok := found[token.entry]; !ok || distance < known {
+				found[token.entry] = distance
+			}
+		}
+	})
+	return found
+}
+
+// relevance scores, a match is worth the score of its field, exact matches are always worth more than ones with typos
+const (
+	scoreExactName     = 100
+	scoreNamePrefix    = 80
+	scoreMember        = 60
+	scoreLocation      = 40
+	scoreDate          = 20
+	scoreExactBonus    = 100 // for matches without typos
+	scorePerTypo       = 10  // taken off for every edit
+	scorePerExtraField = 5   // for every other field of the same artist that matches too
+)
+
+// how relevant a match with an entry is
+func entryScore(entry searchEntry, query string, distance int) int {
+	score := scoreDate
+	switch entry.Kind {
+	case kindArtist:
+		score = scoreNamePrefix
+		if utils.FoldText(entry.Label) == utils.FoldText(query) {
+			score = scoreExactName
+		}
+	case kindMember:
+		score = scoreMember
+	case kindLocation:
+		score = scoreLocation
+	}
+
+	if distance == 0 {
+		return score + scoreExactBonus
+	}
+	return score - distance*scorePerTypo
+}
+
+// most suggestions the search bar gets, a short query can match a good part of the catalog
+const maxSuggestions = 50
+
+// returns the best suggestions matching the search bar text, each with all the artists it leads to and its score.
+// The most relevant come first, then they're ordered by kind and alphabetically.
+// A picked suggestion, "Queen - artist/band", only matches exactly
+func (index *SearchIndex) Search(query string) []Suggestion {
+	query, kind := splitKindSuffix(query)
+	suggestions := index.search(query, kind, kind == "")
+
+	//cut after ranking so the best are kept, only the ones sent get their own artist lists and match ranges
+	suggestions = suggestions[:min(len(suggestions), maxSuggestions)]
+	for i := range suggestions {
+		suggestions[i].ArtistIDs = slices.Clone(suggestions[i].ArtistIDs)
+		suggestions[i].MatchRange = matchRange(suggestions[i].Label, query)
+	}
+	return suggestions
+}
+
+// returns every suggestion of a kind, or of every kind if kind is "", matching the query.
+// They share their artist lists with the index and have no match ranges
+func (index *SearchIndex) search(query, kind string, fuzzy bool) []Suggestion {
+	suggestions := []Suggestion{}
+	for i, distance := range index.lookup(query, fuzzy) {
+		entry := index.entries[i]
+		if kind != "" && entry.Kind != kind {
+			continue
+		}
+		suggestion := newSuggestion(entry.Label, entry.Kind, entry.ArtistIDs)
+		suggestion.Score = entryScore(entry, query, distance)
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+
+		iVal, jVal := kindOrder[suggestions[i].Kind], kindOrder[suggestions[j].Kind]
+
+		//if same category, sort by name
+		if iVal == jVal {
+			return suggestions[i].Value < suggestions[j].Value
+		}
+
+		return iVal < jVal
+	})
+
+	return suggestions
+}
+
+// returns the scores of the artists the suggestions lead to, by artist ID.
+// An artist scores its best match, plus a bit for every other field that matches
+func scoreArtists(suggestions []Suggestion) map[int]int {
+	best := map[int]int{}
+	fields := map[int]map[string]bool{}
+	for _, suggestion := range suggestions {
+		for _, id := range suggestion.ArtistIDs {
+			best[id] = max(best[id], suggestion.Score)
+			if fields[id] == nil {
+				fields[id] = map[string]bool{}
+			}
+			fields[id][suggestion.Kind] = true
+		}
+	}
+
+	scores := map[int]int{}
+	for id, score := range best {
+		scores[id] = score + (len(fields[id])-1)*scorePerExtraField
+	}
+	return scores
+}
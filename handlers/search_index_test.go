@@ -0,0 +1,287 @@
+package api
+
+import (
+	"fmt"
+	"groupie/utils"
+	"math/rand"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// roughly the size of the upstream API's catalog
+const upstreamArtists = 52
+
+var syllables = []string{"ka", "ro", "mi", "ten", "lu", "sa", "vor", "el", "qui", "dan", "bri", "zo", "pha", "nel", "tor", "gu"}
+
+var syntheticCities = []string{
+	"london-uk", "osaka-japan", "los_angeles-usa", "new_york-usa", "paris-france", "berlin-germany", "sao_paulo-brazil",
+	"sydney-australia", "madrid-spain", "rome-italy", "oslo-norway", "mumbai-india", "toronto-canada", "seoul-south_korea",
+}
+
+func syntheticWord(random *rand.Rand) string {
+	var builder strings.Builder
+	for range 2 + random.Intn(2) {
+		builder.WriteString(syllables[random.Intn(len(syllables))])
+	}
+	return strings.ToUpper(builder.String()[:1]) + builder.String()[1:]
+}
+
+// makes a catalog of the given number of artists, always the same one for the same size
+func syntheticCatalog(size int) FixtureSource {
+	random := rand.New(rand.NewSource(int64(size)))
+	source := FixtureSource{}
+
+	for id := 1; id <= size; id++ {
+		members := []string{}
+		for range 1 + random.Intn(6) {
+			members = append(members, syntheticWord(random)+" "+syntheticWord(random))
+		}
+
+		year := 1958 + random.Intn(60)
+		source.Artists = append(source.Artists, Artist{
+			ID:           id,
+			Name:         syntheticWord(random) + " " + syntheticWord(random),
+			Members:      members,
+			CreationDate: year,
+			FirstAlbum:   fmt.Sprintf("%02d-%02d-%d", 1+random.Intn(28), 1+random.Intn(12), year+random.Intn(5)),
+		})
+
+		datesLocations := map[string][]string{}
+		for range 1 + random.Intn(8) {
+			location := syntheticCities[random.Intn(len(syntheticCities))]
+			date := fmt.Sprintf("%02d-%02d-%d", 1+random.Intn(28), 1+random.Intn(12), 2019+random.Intn(7))
+			datesLocations[location] = append(datesLocations[location], date)
+		}
+		source.Relations = append(source.Relations, Relation{ID: id, DatesLocations: datesLocations})
+	}
+
+	return source
+}
+
+// the prefix match the search did before the index, ignoring case
+func sameEnough(a, b string) bool {
+	return strings.HasPrefix(strings.ToLower(a), strings.ToLower(b))
+}
+
+// the search as it was before the index: every field of every artist checked for a prefix match,
+// with diacritics folded as search does now. Returns the matching suggestion values with the artists they lead to
+func scanSearch(query string, data *Dataset) map[string][]int {
+	query, kind := splitKindSuffix(query)
+	query = utils.FoldText(query)
+	matches := map[string][]int{}
+	add := func(artistID int, matchKind, label string, forms ...string) {
+		if kind != "" && kind != matchKind {
+			return
+		}
+		for _, form := range forms {
+			form = utils.FoldText(form)
+			words := append([]string{form}, utils.SplitByWords(form)...)
+			if slices.ContainsFunc(words, func(word string) bool { return sameEnough(word, query) }) {
+				value := label + " - " + matchKind
+				if !slices.Contains(matches[value], artistID) {
+					matches[value] = append(matches[value], artistID)
+				}
+				return
+			}
+		}
+	}
+
+	for _, artist := range data.Artists {
+		add(artist.ID, kindArtist, artist.Name, artist.Name)
+		for _, member := range artist.Members {
+			add(artist.ID, kindMember, member, member)
+		}
+		if kind == "" || kind == kindCreationDate {
+			if year := fmt.Sprint(artist.CreationDate); sameEnough(year, query) {
+				matches[year+" - "+kindCreationDate] = append(matches[year+" - "+kindCreationDate], artist.ID)
+			}
+		}
+		add(artist.ID, kindFirstAlbum, artist.FirstAlbum, artist.FirstAlbum)
+		for _, location := range concertLocations(data.Concerts.ByArtist[artist.ID]) {
+			add(artist.ID, kindLocation, utils.FixKey(location), location, utils.FixKey(location), strings.ReplaceAll(location, "-", " "))
+		}
+	}
+	return matches
+}
+
+// without typos the index finds exactly what scanning every artist finds
+func TestSearchIndexMatchesScan(t *testing.T) {
+	queries := []string{
+		"q", "fre", "Queen", "lon", "London - concert location", "1970", "19", "12", "osaka japan", "los_angeles",
+		"sao", "may - member", "ka", "Ro", "tor - artist/band", "2019", "zzz",
+	}
+	for name, source := range map[string]FixtureSource{"fixture": testFixture(), "synthetic": syntheticCatalog(upstreamArtists)} {
+		data := useFixture(t, source)
+		for _, query := range queries {
+			want := scanSearch(query, data)
+
+			got := map[string][]int{}
+			stripped, kind := splitKindSuffix(query)
+			for _, suggestion := range data.Search.search(stripped, kind, false) {
+				got[suggestion.Value] = suggestion.ArtistIDs
+			}
+
+			for value, ids := range want {
+				slices.Sort(ids)
+				slices.Sort(got[value])
+				if !slices.Equal(ids, got[value]) {
+					t.Errorf("%s, %q: %q leads to %v, the scan found %v", name, query, value, got[value], ids)
+				}
+			}
+			for value := range got {
+				if _, ok := want[value]; !ok {
+					t.Errorf("%s, %q: %q found, the scan didn't find it", name, query, value)
+				}
+			}
+		}
+	}
+}
+
+// short queries match much of the catalog, only the best ranked suggestions are sent
+func TestSearchCapped(t *testing.T) {
+	data := useFixture(t, syntheticCatalog(upstreamArtists*10))
+
+	for _, query := range []string{"ka", "ro - member", "zzz"} {
+		stripped, kind := splitKindSuffix(query)
+		all := data.Search.search(stripped, kind, kind == "")
+		suggestions := data.Search.Search(query)
+
+		if len(suggestions) != min(len(all), maxSuggestions) {
+			t.Errorf("%q: %d suggestions of %d, want at most %d", query, len(suggestions), len(all), maxSuggestions)
+		}
+		for i, suggestion := range suggestions {
+			if suggestion.Value != all[i].Value || suggestion.Score != all[i].Score {
+				t.Errorf("%q: suggestion %d is %q, the best ranked is %q", query, i, suggestion.Value, all[i].Value)
+			}
+		}
+	}
+}
+
+// an exact name comes before a name starting with the search, then members, locations and anything with a typo
+func TestSearchRanking(t *testing.T) {
+	band := validArtist(3, "The Band")
+	band.Members = []string{"Queenie Jones"}
+	data := useFixture(t, FixtureSource{
+		Artists: []Artist{validArtist(1, "Qween"), validArtist(2, "Queensryche"), band, validArtist(4, "Queen"), validArtist(5, "Toured")},
+		Relations: []Relation{
+			{ID: 1, DatesLocations: map[string][]string{"london-uk": {"01-01-2020"}}},
+			{ID: 2, DatesLocations: map[string][]string{"london-uk": {"01-01-2020"}}},
+			{ID: 3, DatesLocations: map[string][]string{"london-uk": {"01-01-2020"}}},
+			{ID: 4, DatesLocations: map[string][]string{"london-uk": {"01-01-2020"}}},
+			{ID: 5, DatesLocations: map[string][]string{"queenstown-new_zealand": {"01-01-2020"}}},
+		},
+	})
+
+	labels := []string{}
+	for _, suggestion := range data.Search.Search("queen") {
+		labels = append(labels, suggestion.Label)
+	}
+	want := []string{"Queen", "Queensryche", "Queenie Jones", "Queenstown - New Zealand", "Qween"}
+	if !slices.Equal(labels, want) {
+		t.Errorf("suggestions %q, want %q", labels, want)
+	}
+}
+
+// number of single character edits (insertions, deletions, substitutions) between the query and the closest prefix of text,
+// so "metalic" is 0 away from "metallica" and "qeen" is 1 away from "queen".
+// Stops counting once it's sure to go over limit, and returns limit+1 then
+func prefixDistance(query, text string, limit int) int {
+	queryRunes, textRunes := []rune(query), []rune(text)
+
+	//previous[j] is the distance between the query so far and the first j runes of text
+	previous := make([]int, len(textRunes)+1)
+	current := make([]int, len(textRunes)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i, q := range queryRunes {
+		current[0] = i + 1
+		for j, t := range textRunes {
+			cost := 1
+			if q == t {
+				cost = 0
+			}
+			current[j+1] = min(previous[j]+cost, previous[j+1]+1, current[j]+1)
+		}
+		previous, current = current, previous
+
+		//the best distance never goes down from one row to the next
+		if slices.Min(previous) > limit {
+			return limit + 1
+		}
+	}
+
+	//the rest of text after the best prefix doesn't count
+	return slices.Min(previous)
+}
+
+// typos are found just like measuring every token of the index would find them
+func TestFuzzyLookupMatchesScan(t *testing.T) {
+	queries := []string{"qeen", "Metalica", "kqro", "tenlu", "karomi", "osaak", "los angelse", "berlni germany", "zzzz", "mótorhead", "sigur ros"}
+	for name, source := range map[string]FixtureSource{"fixture": testFixture(), "synthetic": syntheticCatalog(upstreamArtists * 10)} {
+		data := useFixture(t, source)
+		for _, query := range queries {
+			folded := utils.FoldText(query)
+			limit := maxDistance(len([]rune(folded)))
+			want := data.Search.lookup(query, false)
+			for _, token := range data.Search.tokens {
+				distance := prefixDistance(folded, token.text, limit)
+				if known, ok := want[token.entry]; distance <= limit && (!ok || distance < known) {
+					want[token.entry] = distance
+				}
+			}
+
+			got := data.Search.lookup(query, true)
+			if len(got) != len(want) {
+				t.Errorf("%s, %q: %d entries found, the scan found %d", name, query, len(got), len(want))
+			}
+			for entry, distance := range want {
+				if known, ok := got[entry]; !ok || known != distance {
+					t.Errorf("%s, %q: %q is %d away, the scan found it %d away", name, query, data.Search.entries[entry].Label, known, distance)
+				}
+			}
+		}
+	}
+}
+
+// runs SuggestionsHandler for every query on a catalog a hundred times the upstream size
+func benchmarkSuggestions(b *testing.B, queries []string) {
+	useFixture(b, syntheticCatalog(upstreamArtists*100))
+
+	for _, query := range queries {
+		target := "/search?query=" + url.QueryEscape(query)
+		b.Run(query, func(b *testing.B) {
+			for range b.N {
+				SuggestionsHandler(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+			}
+		})
+	}
+}
+
+var benchmarkQueries = []string{"a", "ka", "kar", "freddie", "osaka", "los angeles", "1987", "ro - member", "zzz"}
+
+func BenchmarkSuggestions(b *testing.B) {
+	benchmarkSuggestions(b, benchmarkQueries)
+}
+
+// the same queries found by scanning every artist like the search did before the index, to compare against
+func BenchmarkSuggestionsScan(b *testing.B) {
+	data := useFixture(b, syntheticCatalog(upstreamArtists*100))
+
+	for _, query := range benchmarkQueries {
+		b.Run(query, func(b *testing.B) {
+			for range b.N {
+				scanSearch(query, data)
+			}
+		})
+	}
+}
+
+// queries with typos, or long enough that typos are looked for
+func BenchmarkSuggestionsFuzzy(b *testing.B) {
+	benchmarkSuggestions(b, []string{"kqro", "tenlu", "karomi", "osaak", "los angelse", "berlni germany", "zzzz"})
+}
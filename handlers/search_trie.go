@@ -0,0 +1,113 @@
+package api
+
+import "slices"
+
+// a trie over the texts of the index's tokens, so typo lookups only visit the texts that can still be close enough
+// instead of measuring every token. Tokens are ordered by text, so each node's subtree is a range of them
+type tokenTrie struct {
+	nodes []trieNode // the root is the first
+}
+
+type trieNode struct {
+	children []trieChild // ordered by rune
+	start    int         // first token under this node
+	exactEnd int         // tokens from start to exactEnd have exactly this node's text
+	end      int         // end of the tokens under this node
+}
+
+type trieChild struct {
+	r    rune
+	node int
+}
+
+// builds the trie of tokens, which must be ordered by text
+func newTokenTrie(tokens []indexToken) *tokenTrie {
+	trie := &tokenTrie{nodes: []trieNode{{}}}
+
+	path := []int{0} //nodes from the root down to the last inserted text
+	for i, token := range tokens {
+		if i > 0 && token.text == tokens[i-1].text {
+			continue
+		}
+
+		//texts come in order, so a text only ever shares the last inserted text's path
+		depth := 0
+		for _, r := range token.text {
+			depth++
+			if depth < len(path) {
+				children := trie.nodes[path[depth-1]].children
+				if last := children[len(children)-1]; last.r == r && last.node == path[depth] {
+					continue
+				}
+				path = path[:depth]
+			}
+			node := len(trie.nodes)
+			trie.nodes = append(trie.nodes, trieNode{start: i, exactEnd: i})
+			trie.nodes[path[depth-1]].children = append(trie.nodes[path[depth-1]].children, trieChild{r: r, node: node})
+			path = append(path, node)
+		}
+		path = path[:depth+1]
+
+		//the tokens with this text end here, and all of the path's subtrees grow by them
+		end := i
+		for end < len(tokens) && tokens[end].text == token.text {
+			end++
+		}
+		trie.nodes[path[depth]].exactEnd = end
+		for _, node := range path {
+			trie.nodes[node].end = end
+		}
+	}
+	return trie
+}
+
+// calls found with the range of tokens at each distance from query that's within limit,
+// the distance being the number of edits between query and the closest prefix of the token
+func (trie *tokenTrie) search(query []rune, limit int, found func(start, end, distance int)) {
+	//rows[depth][i] is the distance between the first i runes of query and the text of the node at depth
+	rows := [][]int{make([]int, len(query)+1)}
+	for i := range rows[0] {
+		rows[0][i] = i
+	}
+
+	var walk func(node, depth, best int)
+	walk = func(node, depth, best int) {
+		current := trie.nodes[node]
+		if depth+1 >= len(rows) {
+			rows = append(rows, make([]int, len(query)+1))
+		}
+		row := rows[depth]
+
+		for _, child := range current.children {
+			next := rows[depth+1]
+			next[0] = row[0] + 1
+			for i, q := range query {
+				cost := 1
+				if q == child.r {
+					cost = 0
+				}
+				next[i+1] = min(row[i]+cost, row[i+1]+1, next[i]+1)
+			}
+
+			childBest := min(best, next[len(query)])
+			lowest := slices.Min(next)
+			switch {
+			case childBest <= limit && lowest >= childBest:
+				//nothing further down can get closer, the whole subtree is this far away
+				found(trie.nodes[child.node].start, trie.nodes[child.node].end, childBest)
+			case lowest <= limit:
+				if childBest <= limit {
+					found(trie.nodes[child.node].start, trie.nodes[child.node].exactEnd, childBest)
+				}
+				walk(child.node, depth+1, childBest)
+			}
+		}
+	}
+
+	root := trie.nodes[0]
+	if len(query) <= limit {
+		found(root.start, root.end, len(query))
+		return
+	}
+	walk(0, 0, len(query))
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"groupie/utils"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// file that holds the last successfully fetched artist data, so the server can start when the upstream API is down
+var snapshotPath = filepath.Join("..", "snapshot", "snapshot.json")
+
+// bump this whenever the layout of the snapshot changes. Snapshots newer than this are ignored,
+// older ones are loaded and whatever they don't have is left empty
+const snapshotVersion = 2
+
+// on-disk layout of the snapshot file
+type snapshotT struct {
+	Version   int        `json:"version"`
+	FetchedAt time.Time  `json:"fetchedAt"`
+	Artists   []Artist   `json:"artists"`
+	Relations []Relation `json:"relations"`
+	Locations []Location `json:"locations"` // since version 2
+	Dates     []Date     `json:"dates"`     // since version 2
+}
+
+func (snapshot snapshotT) sourceData() SourceData {
+	return SourceData{
+		Artists:   snapshot.Artists,
+		Relations: snapshot.Relations,
+		Locations: snapshot.Locations,
+		Dates:     snapshot.Dates,
+	}
+}
+
+// checks if there is a snapshot file on disk
+func snapshotExists() bool {
+	_, err := os.Stat(snapshotPath)
+	return err == nil
+}
+
+// Saves the loaded data into the snapshot file
+func SaveSnapshot(sourceData SourceData, fetchedAt time.Time) error {
+	snapshot := snapshotT{
+		Version:   snapshotVersion,
+		FetchedAt: fetchedAt,
+		Artists:   sourceData.Artists,
+		Relations: sourceData.Relations,
+		Locations: sourceData.Locations,
+		Dates:     sourceData.Dates,
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	//a crash mid-write doesn't destroy the old snapshot
+	return utils.WriteFileAtomic(snapshotPath, data, 0644)
+}
+
+// Loads the data from the snapshot file
+func LoadSnapshot() (snapshotT, error) {
+	var snapshot snapshotT
+
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		return snapshot, err
+	}
+
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return snapshot, fmt.Errorf("corrupted snapshot: %v", err)
+	}
+
+	if snapshot.Version < 1 || snapshot.Version > snapshotVersion {
+		return snapshot, fmt.Errorf("snapshot version %d is not supported, expected %d", snapshot.Version, snapshotVersion)
+	}
+
+	if len(snapshot.Artists) == 0 {
+		return snapshot, errors.New("snapshot has no artists")
+	}
+
+	return snapshot, nil
+}
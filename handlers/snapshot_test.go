@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// points the snapshot into a directory of the test's own, put back when the test ends
+func useTempSnapshot(t *testing.T) {
+	oldPath := snapshotPath
+	snapshotPath = filepath.Join(t.TempDir(), "snapshot.json")
+	t.Cleanup(func() { snapshotPath = oldPath })
+}
+
+// serves the test fixture like the upstream API does while up is true, fails while it's false
+func newFixtureServer(t *testing.T, up *atomic.Bool) *httptest.Server {
+	source := testFixture()
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !up.Load() {
+			http.Error(writer, "down", http.StatusServiceUnavailable)
+			return
+		}
+		switch request.URL.Path {
+		case "/artists":
+			json.NewEncoder(writer).Encode(source.Artists)
+		case "/relation":
+			json.NewEncoder(writer).Encode(relationResponse{Relations: source.Relations})
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSnapshotFallback(t *testing.T) {
+	useTempSnapshot(t)
+	up := &atomic.Bool{}
+	up.Store(true)
+	server := newFixtureServer(t, up)
+
+	//a pointer, any remote source falls back the same
+	source := &HTTPSource{ArtistsURL: server.URL + "/artists", RelationURL: server.URL + "/relation", MaxRetries: 1}
+
+	//no snapshot yet, a failure is an error
+	up.Store(false)
+	if _, err := LoadArtistData(source); err == nil {
+		t.Fatal("loaded with the source down and no snapshot")
+	}
+
+	up.Store(true)
+	live, err := LoadArtistData(source)
+	if err != nil {
+		t.Fatal("loading from the source:", err)
+	}
+	if live.FromSnapshot || !snapshotExists() {
+		t.Fatalf("from snapshot %v, snapshot saved %v", live.FromSnapshot, snapshotExists())
+	}
+
+	up.Store(false)
+	fallback, err := LoadArtistData(source)
+	if err != nil {
+		t.Fatal("loading with the source down:", err)
+	}
+	if !fallback.FromSnapshot || !fallback.FetchedAt.Equal(live.FetchedAt) {
+		t.Errorf("from snapshot %v, fetched at %v, want the snapshot from %v", fallback.FromSnapshot, fallback.FetchedAt, live.FetchedAt)
+	}
+	if names, want := artistNames(fallback.Artists), artistNames(live.Artists); !slices.Equal(names, want) {
+		t.Errorf("artists from the snapshot %q, want %q", names, want)
+	}
+	if len(fallback.Concerts.ByDate) != len(live.Concerts.ByDate) {
+		t.Errorf("%d concerts from the snapshot, want %d", len(fallback.Concerts.ByDate), len(live.Concerts.ByDate))
+	}
+	if !strings.HasPrefix(fallback.AgeText(), "Offline snapshot") {
+		t.Errorf("age text %q", fallback.AgeText())
+	}
+
+	//local sources have nothing to fall back on
+	if _, err := LoadArtistData(failingSource{}); err == nil {
+		t.Error("a failing local source fell back to the snapshot")
+	}
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	fetchedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	current, err := json.Marshal(snapshotT{
+		Version:   snapshotVersion,
+		FetchedAt: fetchedAt,
+		Artists:   testFixture().Artists,
+		Relations: testFixture().Relations,
+		Locations: []Location{{ID: 1, Locations: []string{"osaka-japan", "london-uk"}}},
+		Dates:     []Date{{ID: 1, Dates: []string{"*28-01-2020", "*10-11-2019"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		file      string
+		wantErr   string // part of the error, "" if it loads
+		artists   int
+		locations int
+	}{
+		{"current version", string(current), "", 3, 1},
+		{"version 1, from before locations and dates", `{"version": 1, "fetchedAt": "2024-05-01T10:00:00Z", "artists": [{"id": 1, "name": "Queen"}], "relations": []}`, "", 1, 0},
+		{"newer version", `{"version": 3, "artists": [{"id": 1, "name": "Queen"}]}`, "version 3 is not supported", 0, 0},
+		{"no version", `{"artists": [{"id": 1, "name": "Queen"}]}`, "version 0 is not supported", 0, 0},
+		{"corrupted", `{"version": 2, "artists": [`, "corrupted snapshot", 0, 0},
+		{"no artists", `{"version": 2, "artists": []}`, "no artists", 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTempSnapshot(t)
+			if err := os.WriteFile(snapshotPath, []byte(test.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			snapshot, err := LoadSnapshot()
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snapshot.Artists) != test.artists || len(snapshot.Locations) != test.locations || !snapshot.FetchedAt.Equal(fetchedAt) {
+				t.Errorf("%d artists, %d locations, fetched at %v", len(snapshot.Artists), len(snapshot.Locations), snapshot.FetchedAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"cmp"
+	"groupie/utils"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sort options of the artist list, by the value of the sort parameter
+var sortOptions = map[string]string{
+	"name":         "Name",
+	"creation":     "Creation year",
+	"first_album":  "First album date",
+	"concerts":     "Number of concerts",
+	"members":      "Number of members",
+	"next_concert": "Next concert",
+	"last_concert": "Last concert",
+}
+
+// order the sort options are listed in
+var sortOptionOrder = []string{"name", "creation", "first_album", "concerts", "members", "next_concert", "last_concert"}
+
+// a sort option as the form shows it
+type sortOption struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+// the sort options for the form, with the filter's one selected
+func sortOptionsFor(filter FilterT) []sortOption {
+	options := []sortOption{{Value: "", Label: "Relevance", Selected: filter.Sort == ""}}
+	for _, value := range sortOptionOrder {
+		options = append(options, sortOption{Value: value, Label: sortOptions[value], Selected: filter.Sort == value})
+	}
+	return options
+}
+
+// orders the artists by the filter's sort option, artists that compare the same keep their order,
+// so without a sort option the list stays in relevance (or upstream) order.
+// Concerts count only inside the date window, and artists without a next or last concert go last either way
+func sortArtists(artists []Artist, filter FilterT, data *Dataset, now time.Time) {
+	if filter.Sort == "" {
+		return
+	}
+
+	concertCounts := map[int]int{}
+	if filter.Sort == "concerts" {
+		for _, artist := range artists {
+			concertCounts[artist.ID] = len(filter.concertsInWindow(data.Concerts.ByArtist[artist.ID]))
+		}
+	}
+
+	//dates the artists are sorted by, zero if they don't have one
+	concertDates := map[int]time.Time{}
+	if filter.Sort == "next_concert" || filter.Sort == "last_concert" {
+		for _, artist := range artists {
+			for _, concert := range filter.concertsInWindow(data.Concerts.ByArtist[artist.ID]) {
+				upcoming := !concert.Date.Before(now)
+				if filter.Sort == "next_concert" && upcoming {
+					concertDates[artist.ID] = concert.Date //concerts are ordered by date, the first upcoming one is the next
+					break
+				}
+				if filter.Sort == "last_concert" && !upcoming {
+					concertDates[artist.ID] = concert.Date
+				}
+			}
+		}
+	}
+
+	compare := func(a, b Artist) int {
+		switch filter.Sort {
+		case "name":
+			return strings.Compare(utils.FoldText(a.Name), utils.FoldText(b.Name))
+		case "creation":
+			return cmp.Compare(a.CreationDate, b.CreationDate)
+		case "first_album":
+			return a.FirstAlbumDate.Compare(b.FirstAlbumDate)
+		case "concerts":
+			return cmp.Compare(concertCounts[a.ID], concertCounts[b.ID])
+		case "members":
+			return cmp.Compare(len(a.Members), len(b.Members))
+		default:
+			return concertDates[a.ID].Compare(concertDates[b.ID])
+		}
+	}
+
+	slices.SortStableFunc(artists, func(a, b Artist) int {
+		if filter.Sort == "next_concert" || filter.Sort == "last_concert" {
+			aMissing, bMissing := concertDates[a.ID].IsZero(), concertDates[b.ID].IsZero()
+			if aMissing != bMissing {
+				if aMissing {
+					return 1
+				}
+				return -1
+			}
+		}
+
+		if filter.Order == "desc" {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+}
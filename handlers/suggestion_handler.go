@@ -4,79 +4,100 @@ import (
 	"encoding/json"
 	"groupie/utils"
 	"net/http"
-	"sort"
-	"strings"
+	"slices"
 )
 
-// handler for search suggestions, responds to a get request from javascript when user changes anything in the search input field
-func SuggestionsHandler(writer http.ResponseWriter, request *http.Request) {
+// kinds of search suggestions, also used as the suffix that scopes a search, "Queen - artist/band"
+const (
+	kindArtist       = "artist/band"
+	kindMember       = "member"
+	kindCreationDate = "creation date"
+	kindFirstAlbum   = "first album"
+	kindLocation     = "concert location"
+)
 
-	query := request.URL.Query().Get("query")
+// order the kinds are shown in
+var kindOrder = map[string]int{
+	kindArtist:       1,
+	kindMember:       2,
+	kindCreationDate: 3,
+	kindFirstAlbum:   4,
+	kindLocation:     5,
+}
 
-	suggestions := []string{}
+// a single search suggestion
+type Suggestion struct {
+	Label      string `json:"label"`           // text shown to the user, "Freddie Mercury"
+	Kind       string `json:"kind"`            // one of the kinds above
+	Value      string `json:"value"`           // what goes into the search bar when the suggestion is picked, "Freddie Mercury - member"
+	ArtistIDs  []int  `json:"artistIDs"`       // the artists the suggestion leads to
+	MatchRange [2]int `json:"matchRange"`      // start and end (exclusive) of the matched part of the label, in characters
+	Score      int    `json:"score,omitempty"` // relevance, only sent in debug mode
+}
 
-	//go through each artist and keep all the matches
-	for _, artist := range Artists {
-		res, _ := searchMatch(query, artist)
-		suggestions = append(suggestions, res...)
+func newSuggestion(label, kind string, artistIDs []int) Suggestion {
+	return Suggestion{
+		Label:     label,
+		Kind:      kind,
+		Value:     label + " - " + kind,
+		ArtistIDs: artistIDs,
 	}
+}
 
-	//put all suggestions into a map to remove any duplicates
-	myMap := make(map[string]int)
-	for _, location := range suggestions {
-		if location[0] >= 'a' && location[0] <= 'z' {
-			parts := strings.Split(location, " - ")
-			myMap[utils.FixKey(parts[0])+" - "+parts[1]] = 1
-		} else {
-			myMap[location] = 1
+// finds where the search word matches the label, at the start of the label or of one of its words.
+// Both are folded first, so "motor" matches the start of "Motörhead".
+// Returns [0, 0] if it can't be found as is, like when a location matched through its "osaka-japan" form
+func matchRange(label, searchWord string) [2]int {
+	//folding can turn one rune into more ("ß" into "ss") or none, so keep which label rune each folded one came from
+	folded := []rune{}
+	origin := []int{}
+	for i, r := range []rune(label) {
+		for _, f := range utils.FoldText(string(r)) {
+			folded = append(folded, f)
+			origin = append(origin, i)
 		}
 	}
 
-	//put em back to the slice
-	suggestions = []string{}
-	for key := range myMap {
-		suggestions = append(suggestions, key)
+	wordRunes := []rune(utils.FoldText(searchWord))
+	if len(wordRunes) == 0 || len(wordRunes) > len(folded) {
+		return [2]int{0, 0}
 	}
 
-	//sort them based on their type and then alphanumerically
-	sort.Slice(suggestions, func(i, j int) bool {
-		iVal := 10
-		switch {
-		case strings.HasSuffix(suggestions[i], " - artist/band"):
-			iVal = 1
-		case strings.HasSuffix(suggestions[i], " - member"):
-			iVal = 2
-		case strings.HasSuffix(suggestions[i], " - creation date"):
-			iVal = 3
-		case strings.HasSuffix(suggestions[i], " - first album"):
-			iVal = 4
-		case strings.HasSuffix(suggestions[i], " - concert location"):
-			iVal = 5
+	for start := 0; start+len(wordRunes) <= len(folded); start++ {
+		wordStart := start == 0 || !utils.IsAlphaNumeric(folded[start-1]) && origin[start] != origin[start-1]
+		if wordStart && slices.Equal(folded[start:start+len(wordRunes)], wordRunes) {
+			return [2]int{origin[start], origin[start+len(wordRunes)-1] + 1}
 		}
+	}
+	return [2]int{0, 0}
+}
 
-		jVal := 10
-		switch {
-		case strings.HasSuffix(suggestions[j], " - artist/band"):
-			jVal = 1
-		case strings.HasSuffix(suggestions[j], " - member"):
-			jVal = 2
-		case strings.HasSuffix(suggestions[j], " - creation date"):
-			jVal = 3
-		case strings.HasSuffix(suggestions[j], " - first album"):
-			jVal = 4
-		case strings.HasSuffix(suggestions[j], " - concert location"):
-			jVal = 5
-		}
+// handler for search suggestions, responds to a get request from javascript when user changes anything in the search input field.
+// Responds with Suggestion objects, or with the old "label - kind" strings if format=strings. debug=1 adds the scores
+func SuggestionsHandler(writer http.ResponseWriter, request *http.Request) {
+
+	query := request.URL.Query().Get("query")
+	legacyFormat := request.URL.Query().Get("format") == "strings"
+	debug := request.URL.Query().Get("debug") == "1"
+	data := Data()
 
-		//if same category, sort by name
-		if iVal == jVal {
-			return suggestions[i] < suggestions[j]
+	suggestions := data.Search.Search(query)
+	if !debug {
+		for i := range suggestions {
+			suggestions[i].Score = 0
 		}
+	}
 
-		return iVal < jVal
-	})
+	var response any = suggestions
+	if legacyFormat {
+		values := make([]string, 0, len(suggestions))
+		for _, suggestion := range suggestions {
+			values = append(values, suggestion.Value)
+		}
+		response = values
+	}
 
-	jsonData, err := json.Marshal(suggestions)
+	jsonData, err := json.Marshal(response)
 	if err != nil {
 		http.Error(writer, "Failed to generate suggestions", http.StatusInternalServerError)
 		return
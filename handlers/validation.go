@@ -0,0 +1,192 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// format all dates are normalized to, the same one upstream uses
+const dateLayout = "02-01-2006"
+
+// date formats we accept from the data source
+var acceptedDateLayouts = []string{"02-01-2006", "2-1-2006", "02/01/2006", "2/1/2006", "2006-01-02"}
+
+// a record (or a part of one) that was left out of the dataset because it didn't pass validation
+type RejectedRecord struct {
+	ArtistID int    `json:"artistId"`
+	Artist   string `json:"artist"`
+	Dropped  string `json:"dropped"` // what was left out, "artist", "location", "date" or "member"
+	Field    string `json:"field"`
+	Value    string `json:"value"`
+	Reason   string `json:"reason"`
+}
+
+// parses a date in any of the accepted formats
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range acceptedDateLayouts {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date in DD-MM-YYYY format", value)
+}
+
+var locationSeparators = regexp.MustCompile(`[\s_]+`)
+
+// normalizes a location key to the "city_name-country_name" format upstream uses, lowercase with underscores for spaces
+func normalizeLocationKey(key string) (string, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(key)), "-")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("%q is not in city-country format", key)
+	}
+	for i, part := range parts {
+		part = locationSeparators.ReplaceAllString(strings.TrimSpace(part), "_")
+		part = strings.Trim(part, "_")
+		if part == "" {
+			return "", fmt.Errorf("%q has an empty city or country", key)
+		}
+		parts[i] = part
+	}
+	return parts[0] + "-" + parts[1], nil
+}
+
+// checks and normalizes the loaded data. Artists that can't be used are left out along with their relation data,
+// so is relation data with no artist, broken concert locations and dates are left out of the artist's relation data, and everything left out is returned with a reason
+func validateSourceData(sourceData SourceData) (SourceData, []RejectedRecord) {
+	rejected := []RejectedRecord{}
+	reject := func(artist Artist, dropped, field, value, reason string) {
+		rejected = append(rejected, RejectedRecord{
+			ArtistID: artist.ID,
+			Artist:   artist.Name,
+			Dropped:  dropped,
+			Field:    field,
+			Value:    value,
+			Reason:   reason,
+		})
+	}
+
+	clean := SourceData{}
+	validIDs := map[int]bool{}
+	maxYear := time.Now().Year() + 1
+
+	for _, artist := range sourceData.Artists {
+		artist.Name = strings.TrimSpace(artist.Name)
+
+		switch {
+		case artist.ID <= 0:
+			reject(artist, "artist", "id", fmt.Sprint(artist.ID), "ID must be a positive number")
+			continue
+		case validIDs[artist.ID]:
+			reject(artist, "artist", "id", fmt.Sprint(artist.ID), "another artist already has this ID")
+			continue
+		case artist.Name == "":
+			reject(artist, "artist", "name", "", "name is empty")
+			continue
+		case artist.CreationDate < 1800 || artist.CreationDate > maxYear:
+			reject(artist, "artist", "creationDate", fmt.Sprint(artist.CreationDate), "creation year is out of range")
+			continue
+		}
+
+		firstAlbum, err := parseDate(artist.FirstAlbum)
+		if err != nil {
+			reject(artist, "artist", "firstAlbum", artist.FirstAlbum, err.Error())
+			continue
+		}
+		artist.FirstAlbum = firstAlbum.Format(dateLayout)
+		artist.FirstAlbumDate = firstAlbum
+
+		members := []string{}
+		for _, member := range artist.Members {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				reject(artist, "member", "members", "", "member name is empty")
+				continue
+			}
+			members = append(members, member)
+		}
+		if len(members) == 0 {
+			reject(artist, "artist", "members", "", "artist has no members")
+			continue
+		}
+		artist.Members = members
+
+		validIDs[artist.ID] = true
+		clean.Artists = append(clean.Artists, artist)
+	}
+
+	artistsByID := make(map[int]Artist, len(clean.Artists))
+	for _, artist := range clean.Artists {
+		artistsByID[artist.ID] = artist
+	}
+
+	for _, relation := range sourceData.Relations {
+		//relation data of an artist that was rejected, or that there's no artist for at all.
+		//The data quality report points out the second kind from the source data
+		artist, ok := artistsByID[relation.ID]
+		if !ok {
+			continue
+		}
+
+		datesLocations := make(map[string][]string, len(relation.DatesLocations))
+		for _, rawKey := range sortedKeys(relation.DatesLocations) {
+			key, err := normalizeLocationKey(rawKey)
+			if err != nil {
+				reject(artist, "location", "datesLocations", rawKey, err.Error())
+				continue
+			}
+
+			for _, rawDate := range relation.DatesLocations[rawKey] {
+				date, err := parseDate(rawDate)
+				if err != nil {
+					reject(artist, "date", "datesLocations."+rawKey, rawDate, err.Error())
+					continue
+				}
+				formatted := date.Format(dateLayout)
+				if !slices.Contains(datesLocations[key], formatted) {
+					datesLocations[key] = append(datesLocations[key], formatted)
+				}
+			}
+		}
+
+		clean.Relations = append(clean.Relations, Relation{ID: relation.ID, DatesLocations: datesLocations})
+	}
+
+	//locations and dates are only used for cross-checking, so they're normalized the same way but nothing is rejected
+	for _, location := range sourceData.Locations {
+		keys := make([]string, 0, len(location.Locations))
+		for _, rawKey := range location.Locations {
+			key, err := normalizeLocationKey(rawKey)
+			if err != nil {
+				key = rawKey
+			}
+			keys = append(keys, key)
+		}
+		location.Locations = keys
+		clean.Locations = append(clean.Locations, location)
+	}
+
+	for _, date := range sourceData.Dates {
+		dates := make([]string, 0, len(date.Dates))
+		for _, rawDate := range date.Dates {
+			star := ""
+			if strings.HasPrefix(rawDate, "*") {
+				star = "*"
+			}
+			parsed, err := parseDate(strings.TrimPrefix(rawDate, "*"))
+			if err != nil {
+				dates = append(dates, rawDate)
+				continue
+			}
+			dates = append(dates, star+parsed.Format(dateLayout))
+		}
+		date.Dates = dates
+		clean.Dates = append(clean.Dates, date)
+	}
+
+	return clean, rejected
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// an artist that passes validation
+func validArtist(id int, name string) Artist {
+	return Artist{ID: id, Name: name, Members: []string{"Someone"}, CreationDate: 1990, FirstAlbum: "01-02-1991"}
+}
+
+// a rejected record, by what it tells about what was left out
+type rejection struct {
+	artistID int
+	dropped  string
+	field    string
+	value    string
+}
+
+func TestValidateSourceData(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    SourceData
+		artists   []string                    // names of the artists in the dataset
+		relations map[int]map[string][]string // relation data in the dataset by artist ID
+		rejected  []rejection
+	}{
+		{
+			name: "valid data is normalized",
+			source: SourceData{
+				Artists: []Artist{{ID: 1, Name: " Queen ", Members: []string{" Freddie Mercury"}, CreationDate: 1970, FirstAlbum: "1973-12-14"}},
+				Relations: []Relation{{ID: 1, DatesLocations: map[string][]string{
+					"Osaka-Japan":     {"28/1/2020", "28-01-2020"},
+					"los angeles-usa": {"2-3-2019"},
+				}}},
+			},
+			artists:   []string{"Queen"},
+			relations: map[int]map[string][]string{1: {"osaka-japan": {"28-01-2020"}, "los_angeles-usa": {"02-03-2019"}}},
+		},
+		{
+			name: "malformed first album",
+			source: SourceData{
+				Artists:   []Artist{validArtist(1, "Queen"), {ID: 2, Name: "Later", Members: []string{"Someone"}, CreationDate: 1990, FirstAlbum: "sometime in 1991"}},
+				Relations: []Relation{{ID: 1, DatesLocations: map[string][]string{"london-uk": {"10-11-2019"}}}, {ID: 2, DatesLocations: map[string][]string{"london-uk": {"11-11-2019"}}}},
+			},
+			artists:   []string{"Queen"},
+			relations: map[int]map[string][]string{1: {"london-uk": {"10-11-2019"}}},
+			rejected:  []rejection{{2, "artist", "firstAlbum", "sometime in 1991"}},
+		},
+		{
+			name: "malformed concert dates",
+			source: SourceData{
+				Artists:   []Artist{validArtist(1, "Queen")},
+				Relations: []Relation{{ID: 1, DatesLocations: map[string][]string{"london-uk": {"31-02-2020", "10-11-2019", "soon"}}}},
+			},
+			artists:   []string{"Queen"},
+			relations: map[int]map[string][]string{1: {"london-uk": {"10-11-2019"}}},
+			rejected:  []rejection{{1, "date", "datesLocations.london-uk", "31-02-2020"}, {1, "date", "datesLocations.london-uk", "soon"}},
+		},
+		{
+			name: "location keys without a country",
+			source: SourceData{
+				Artists:   []Artist{validArtist(1, "Queen")},
+				Relations: []Relation{{ID: 1, DatesLocations: map[string][]string{"london": {"10-11-2019"}, "paris-": {"11-11-2019"}, "osaka-japan": {"28-01-2020"}}}},
+			},
+			artists:   []string{"Queen"},
+			relations: map[int]map[string][]string{1: {"osaka-japan": {"28-01-2020"}}},
+			rejected:  []rejection{{1, "location", "datesLocations", "london"}, {1, "location", "datesLocations", "paris-"}},
+		},
+		{
+			name: "duplicate and zero IDs",
+			source: SourceData{
+				Artists:   []Artist{validArtist(1, "Queen"), validArtist(1, "Impostor"), validArtist(0, "Nobody")},
+				Relations: []Relation{{ID: 1, DatesLocations: map[string][]string{"london-uk": {"10-11-2019"}}}},
+			},
+			artists:   []string{"Queen"},
+			relations: map[int]map[string][]string{1: {"london-uk": {"10-11-2019"}}},
+			rejected:  []rejection{{1, "artist", "id", "1"}, {0, "artist", "id", "0"}},
+		},
+		{
+			name: "empty members",
+			source: SourceData{
+				Artists: []Artist{
+					{ID: 1, Name: "Queen", Members: []string{"Brian May", " "}, CreationDate: 1970, FirstAlbum: "14-12-1973"},
+					{ID: 2, Name: "Ghosts", Members: []string{""}, CreationDate: 1990, FirstAlbum: "01-02-1991"},
+					{ID: 3, Name: "Nobody", CreationDate: 1990, FirstAlbum: "01-02-1991"},
+				},
+				Relations: []Relation{{ID: 1, DatesLocations: map[string][]string{}}, {ID: 2, DatesLocations: map[string][]string{"london-uk": {"10-11-2019"}}}},
+			},
+			artists:   []string{"Queen"},
+			relations: map[int]map[string][]string{1: {}},
+			rejected:  []rejection{{1, "member", "members", ""}, {2, "member", "members", ""}, {2, "artist", "members", ""}, {3, "artist", "members", ""}},
+		},
+		{
+			name: "relation data with no artist",
+			source: SourceData{
+				Artists:   []Artist{validArtist(1, "Queen")},
+				Relations: []Relation{{ID: 1, DatesLocations: map[string][]string{"london-uk": {"10-11-2019"}}}, {ID: 9, DatesLocations: map[string][]string{"berlin-germany": {"05-12-2019"}}}},
+			},
+			artists:   []string{"Queen"},
+			relations: map[int]map[string][]string{1: {"london-uk": {"10-11-2019"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := NewDataset(test.source, time.Now(), false)
+
+			if names := artistNames(data.Artists); !slices.Equal(names, test.artists) {
+				t.Errorf("artists %q, want %q", names, test.artists)
+			}
+
+			if len(data.ArtistRelationMap) != len(test.relations) {
+				t.Errorf("relation data for %d artists, want %d", len(data.ArtistRelationMap), len(test.relations))
+			}
+			for id, want := range test.relations {
+				got := data.ArtistRelationMap[id].DatesLocations
+				if len(got) != len(want) {
+					t.Errorf("artist %d: relation data %v, want %v", id, got, want)
+					continue
+				}
+				for location, dates := range want {
+					if !slices.Equal(got[location], dates) {
+						t.Errorf("artist %d, %s: dates %q, want %q", id, location, got[location], dates)
+					}
+				}
+			}
+			//the concerts are built from the relation data that's left
+			for _, concert := range data.Concerts.ByDate {
+				if _, ok := test.relations[concert.ArtistID]; !ok {
+					t.Errorf("concert of artist %d, who isn't in the dataset", concert.ArtistID)
+				}
+			}
+
+			got := []rejection{}
+			for _, record := range data.Rejected {
+				got = append(got, rejection{record.ArtistID, record.Dropped, record.Field, record.Value})
+				if record.Reason == "" {
+					t.Errorf("%+v has no reason", record)
+				}
+			}
+			if !slices.Equal(got, test.rejected) {
+				t.Errorf("rejected %+v, want %+v", got, test.rejected)
+			}
+		})
+	}
+}
+
+// relation data with no artist isn't served, but the data quality report still points it out
+func TestOrphanRelationReported(t *testing.T) {
+	source := SourceData{
+		Artists:   []Artist{validArtist(1, "Queen")},
+		Relations: []Relation{{ID: 1, DatesLocations: map[string][]string{}}, {ID: 9, DatesLocations: map[string][]string{"berlin-germany": {"05-12-2019"}}}},
+	}
+	data := NewDataset(source, time.Now(), false)
+
+	if _, ok := data.ArtistRelationMap[9]; ok || len(data.Relations) != 1 {
+		t.Errorf("relation data %+v, want only artist 1's", data.Relations)
+	}
+	if !slices.ContainsFunc(data.Quality.Issues, func(issue QualityIssue) bool {
+		return issue.ArtistID == 9 && issue.Kind == issueMissingArtist
+	}) {
+		t.Errorf("issues %+v, want ID 9's missing artist", data.Quality.Issues)
+	}
+}
@@ -6,6 +6,27 @@ first_album_year_end.oninput = () => (first_album_year_end_d.textContent = first
 
 
 // SUGGESTIONS
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+// label with the part that matched the query wrapped in <mark>
+function highlightLabel(suggestion) {
+    const [start, end] = suggestion.matchRange;
+    const label = suggestion.label;
+    if (end <= start) {
+        return escapeHTML(label);
+    }
+    const chars = Array.from(label);
+    return escapeHTML(chars.slice(0, start).join('')) +
+        '<mark>' + escapeHTML(chars.slice(start, end).join('')) + '</mark>' +
+        escapeHTML(chars.slice(end).join(''));
+}
+
+let currentSuggestions = [];
+
 function fetchSuggestions() {
     const query = document.querySelector('.searchbar').value;
     
@@ -16,16 +37,18 @@ function fetchSuggestions() {
         return;
     }
 
-    //send query to server
-    fetch(`/search?query=${encodeURIComponent(query)}`)
-    .then(response => response.json())  // Assuming server returns a JSON array
+    //send query to server, in debug mode ask for the scores too
+    const debug = new URLSearchParams(window.location.search).get('debug') === '1';
+    fetch(`/search?query=${encodeURIComponent(query)}${debug ? '&debug=1' : ''}`)
+    .then(response => response.json())  // server returns a JSON array of suggestion objects
     .then(suggestions => {
+        currentSuggestions = suggestions;
         if (suggestions.length === 0) {
             document.getElementById('suggestions').style.display = 'none'; // Hide if no suggestions
         } else {
             //generate suggestions
             const suggestionsList = suggestions.map((suggestion, index) => 
-                `<li class="suggestion-element" data-index="${index}">${suggestion}</li>`
+                `<li class="suggestion-element" data-index="${index}">${highlightLabel(suggestion)} <span class="suggestion-kind">${escapeHTML(suggestion.kind)}</span>${debug ? ` <span class="debug-score">${suggestion.score}</span>` : ''}</li>`
             ).join('');
             const suggestionsElement = document.getElementById('suggestions');
             suggestionsElement.innerHTML = suggestionsList;
@@ -37,12 +60,18 @@ function fetchSuggestions() {
 
 // CLICK ON SUGGESTIONS
 document.getElementById('suggestions').addEventListener('click', function(event) {
-    const clickedElement = event.target;
+    const clickedElement = event.target.closest('li');
     
     // Ensure it's a <li> element
-    if (clickedElement.tagName.toLowerCase() === 'li') {
-        document.querySelector('.searchbar').value = clickedElement.textContent;  // Set the value in search bar
+    if (clickedElement) {
+        const suggestion = currentSuggestions[clickedElement.dataset.index];
+        document.querySelector('.searchbar').value = suggestion.value;  // Set the value in search bar
         document.getElementById('suggestions').style.display = 'none'; // Hide suggestions after selection
+
+        // an artist leads straight to its page
+        if (suggestion.kind === 'artist/band' && suggestion.artistIDs.length === 1) {
+            setArtistID(suggestion.artistIDs[0]);
+        }
     }
 });
 
@@ -83,19 +112,27 @@ function resetFilters() {
         checkbox.checked = valuesToCheck.includes(checkbox.value);
     });
 
-    const dropdown = document.getElementById('concert-dropdown');
-    const anyOption = dropdown.querySelector('option[value="any"]');
-    
-    // If "any" option exists, set it as the selected one
-    if (anyOption) {
-        anyOption.selected = true;
-    }
+    // nothing selected means every location
+    document.querySelectorAll('.location-select option').forEach(option => {
+        option.selected = false;
+    });
+    document.querySelector('input[name="location_match"][value="any"]').checked = true;
+
+    document.getElementById('concert_date_start').value = '';
+    document.getElementById('concert_date_end').value = '';
+    document.getElementById('near').value = '';
+    document.getElementById('radius_km').value = '';
 
     
 }
 
 
 
+ // changed filters start from the first page again, picking an artist (setArtistID) stays on the same page
+document.getElementById('artist_filters').addEventListener('submit', function() {
+    document.getElementById('page').value = 1;
+});
+
  // CLICK ON IMAGE
  function setArtistID(id) {
     // Set the value of the hidden input field to the clicked artist's ID
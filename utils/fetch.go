@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// settings for LoadDataFromURLWithOptions, anything left at zero uses the default
+type FetchOptions struct {
+	Client     *http.Client  // defaults to http.DefaultClient
+	Timeout    time.Duration // timeout of a single attempt, defaults to 10 seconds
+	MaxRetries int           // defaults to 1
+	BaseDelay  time.Duration // wait after the first failed attempt, doubles after every failure, defaults to 500ms
+	MaxDelay   time.Duration // the wait between attempts never goes above this, defaults to 30 seconds
+}
+
+func (options FetchOptions) withDefaults() FetchOptions {
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	if options.MaxRetries <= 0 {
+		options.MaxRetries = 1
+	}
+	if options.BaseDelay <= 0 {
+		options.BaseDelay = 500 * time.Millisecond
+	}
+	if options.MaxDelay <= 0 {
+		options.MaxDelay = 30 * time.Second
+	}
+	return options
+}
+
+// a response kept around so the next request for the same URL can be conditional, or skipped while it's still fresh
+type cachedResponse struct {
+	body         []byte
+	etag         string
+	lastModified string
+	freshUntil   time.Time
+}
+
+type responseCacheT struct {
+	cache map[string]cachedResponse
+	mutex sync.Mutex
+}
+
+func (RC *responseCacheT) get(URL string) (cachedResponse, bool) {
+	RC.mutex.Lock()
+	response, ok := RC.cache[URL]
+	RC.mutex.Unlock()
+	return response, ok
+}
+
+func (RC *responseCacheT) set(URL string, response cachedResponse) {
+	RC.mutex.Lock()
+	RC.cache[URL] = response
+	RC.mutex.Unlock()
+}
+
+func (RC *responseCacheT) remove(URL string) {
+	RC.mutex.Lock()
+	delete(RC.cache, URL)
+	RC.mutex.Unlock()
+}
+
+var responseCache = &responseCacheT{cache: make(map[string]cachedResponse)}
+
+// a response status that isn't a success
+type statusError struct {
+	code   int
+	status string
+}
+
+func (err *statusError) Error() string {
+	return "unexpected response status: " + err.status
+}
+
+// server errors, timeouts and rate limits can go away, any other status comes back the same however often it's asked for
+func (err *statusError) retryable() bool {
+	return err.code >= 500 || err.code == http.StatusRequestTimeout || err.code == http.StatusTooEarly || err.code == http.StatusTooManyRequests
+}
+
+// downloads JSON from a URL into result, retrying with exponential backoff. Responses are cached by URL,
+// repeated requests are conditional (ETag/Last-Modified) and are skipped entirely while Cache-Control says they're fresh.
+// A status that retrying can't fix, like a 404, fails right away
+func LoadDataFromURLWithOptions[T any](URL string, result *T, options FetchOptions) (*T, error) {
+	options = options.withDefaults()
+
+	var err error
+	attempts := 0
+	for attempt := range options.MaxRetries {
+		attempts++
+		err = attemptRequest(URL, result, options)
+		if err == nil {
+			return result, nil
+		}
+
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && !statusErr.retryable() {
+			break
+		}
+
+		//no point waiting after the last attempt
+		if attempt < options.MaxRetries-1 {
+			time.Sleep(backoffDelay(attempt, options))
+		}
+	}
+
+	return nil, fmt.Errorf("failed to fetch link after %d attempts: %w", attempts, err)
+}
+
+// exponential backoff with jitter, somewhere between half and all of BaseDelay*2^attempt
+func backoffDelay(attempt int, options FetchOptions) time.Duration {
+	delay := options.MaxDelay
+	if attempt < 30 { //avoid overflowing the shift
+		delay = min(options.BaseDelay<<attempt, options.MaxDelay)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func attemptRequest[T any](URL string, result *T, options FetchOptions) error {
+	cached, haveCached := responseCache.get(URL)
+
+	//still fresh, no need to ask the server at all
+	if haveCached && time.Now().Before(cached.freshUntil) {
+		return unmarshalBody(cached.body, result)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
+	if err != nil {
+		return fmt.Errorf("request creation failed: %w", err)
+	}
+
+	if haveCached {
+		if cached.etag != "" {
+			request.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			request.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	response, err := options.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var body []byte
+	switch {
+	case response.StatusCode == http.StatusNotModified && haveCached:
+		body = cached.body
+
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		body, err = io.ReadAll(response.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %v", err)
+		}
+
+	default:
+		return &statusError{code: response.StatusCode, status: response.Status}
+	}
+
+	if err := unmarshalBody(body, result); err != nil {
+		return err
+	}
+
+	cacheResponse(URL, body, response.Header, cached)
+
+	return nil
+}
+
+func unmarshalBody[T any](body []byte, result *T) error {
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("failed to unmarshal data: %v", err)
+	}
+	return nil
+}
+
+// stores the response for the next request, following its Cache-Control header.
+// previous is the old cached response, its validators are kept if a 304 didn't send new ones
+func cacheResponse(URL string, body []byte, header http.Header, previous cachedResponse) {
+	maxAge, noStore := parseCacheControl(header.Get("Cache-Control"))
+	if noStore {
+		responseCache.remove(URL)
+		return
+	}
+
+	response := cachedResponse{
+		body:         body,
+		etag:         header.Get("ETag"),
+		lastModified: header.Get("Last-Modified"),
+	}
+	if response.etag == "" {
+		response.etag = previous.etag
+	}
+	if response.lastModified == "" {
+		response.lastModified = previous.lastModified
+	}
+	if maxAge > 0 {
+		response.freshUntil = time.Now().Add(maxAge)
+	}
+
+	//nothing to revalidate with and not fresh for any time, no point keeping it
+	if response.etag == "" && response.lastModified == "" && response.freshUntil.IsZero() {
+		responseCache.remove(URL)
+		return
+	}
+
+	responseCache.set(URL, response)
+}
+
+// returns how long a response stays fresh, and whether it may be stored at all. no-cache means it always has to be revalidated
+func parseCacheControl(value string) (time.Duration, bool) {
+	var maxAge time.Duration
+	noCache := false
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store":
+			return 0, true
+		case directive == "no-cache":
+			noCache = true
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil && seconds > 0 {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if noCache {
+		return 0, false
+	}
+	return maxAge, false
+}
@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a server for the fetch tests, answering every request with respond, and the requests it got
+type fetchServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []*http.Request
+}
+
+func newFetchServer(t *testing.T, respond func(writer http.ResponseWriter, request *http.Request, count int)) *fetchServer {
+	server := &fetchServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		server.mutex.Lock()
+		server.requests = append(server.requests, request)
+		count := len(server.requests)
+		server.mutex.Unlock()
+		respond(writer, request, count)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *fetchServer) requestCount() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return len(server.requests)
+}
+
+func (server *fetchServer) request(i int) *http.Request {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.requests[i]
+}
+
+// fast retries, so the tests don't wait
+var testFetchOptions = FetchOptions{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+type fetchedValue struct {
+	Value string `json:"value"`
+}
+
+func fetchValue(t *testing.T, URL string, options FetchOptions) (string, error) {
+	t.Helper()
+	result := fetchedValue{}
+	_, err := LoadDataFromURLWithOptions(URL, &result, options)
+	return result.Value, err
+}
+
+func TestFetchConditionalRequests(t *testing.T) {
+	const lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+	server := newFetchServer(t, func(writer http.ResponseWriter, request *http.Request, count int) {
+		if request.Header.Get("If-None-Match") == `"v1"` {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.Header().Set("ETag", `"v1"`)
+		writer.Header().Set("Last-Modified", lastModified)
+		writer.Write([]byte(`{"value": "first"}`))
+	})
+
+	for i := range 2 {
+		value, err := fetchValue(t, server.URL, testFetchOptions)
+		if err != nil || value != "first" {
+			t.Fatalf("fetch %d: %q, %v", i+1, value, err)
+		}
+	}
+
+	if count := server.requestCount(); count != 2 {
+		t.Fatalf("%d requests, want 2", count)
+	}
+	if header := server.request(0).Header; header.Get("If-None-Match") != "" || header.Get("If-Modified-Since") != "" {
+		t.Errorf("first request is conditional: %v", header)
+	}
+	//the 304 is answered with the cached body
+	header := server.request(1).Header
+	if header.Get("If-None-Match") != `"v1"` || header.Get("If-Modified-Since") != lastModified {
+		t.Errorf("second request: If-None-Match %q, If-Modified-Since %q", header.Get("If-None-Match"), header.Get("If-Modified-Since"))
+	}
+}
+
+func TestFetchCacheControl(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		etag         string
+		wantRequests int // for two fetches
+		wantRevalid  bool
+	}{
+		{"fresh within max-age", "max-age=60", "", 1, false},
+		{"no-store isn't kept", "no-store, max-age=60", `"v1"`, 2, false},
+		{"no-cache is revalidated", "no-cache, max-age=60", `"v1"`, 2, true},
+		{"nothing to revalidate with", "", "", 2, false},
+		{"stale, revalidated", "max-age=0", `"v1"`, 2, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFetchServer(t, func(writer http.ResponseWriter, request *http.Request, count int) {
+				if test.cacheControl != "" {
+					writer.Header().Set("Cache-Control", test.cacheControl)
+				}
+				if test.etag != "" {
+					writer.Header().Set("ETag", test.etag)
+				}
+				writer.Write([]byte(`{"value": "body"}`))
+			})
+
+			for i := range 2 {
+				if value, err := fetchValue(t, server.URL, testFetchOptions); err != nil || value != "body" {
+					t.Fatalf("fetch %d: %q, %v", i+1, value, err)
+				}
+			}
+
+			if count := server.requestCount(); count != test.wantRequests {
+				t.Fatalf("%d requests, want %d", count, test.wantRequests)
+			}
+			if count := server.requestCount(); count == 2 {
+				revalidated := server.request(1).Header.Get("If-None-Match") != ""
+				if revalidated != test.wantRevalid {
+					t.Errorf("second request conditional: %v, want %v", revalidated, test.wantRevalid)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int // responses before a good one
+		wantErr      bool
+		wantRequests int
+	}{
+		{"server errors are retried", []int{503, 500}, false, 3},
+		{"rate limits are retried", []int{429}, false, 2},
+		{"gives up after MaxRetries", []int{503, 503, 503}, true, 3},
+		{"not found fails right away", []int{404}, true, 1},
+		{"forbidden fails right away", []int{403}, true, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFetchServer(t, func(writer http.ResponseWriter, request *http.Request, count int) {
+				if count <= len(test.statuses) {
+					http.Error(writer, "no", test.statuses[count-1])
+					return
+				}
+				writer.Write([]byte(`{"value": "body"}`))
+			})
+
+			_, err := fetchValue(t, server.URL, testFetchOptions)
+			if (err != nil) != test.wantErr {
+				t.Errorf("error %v, want one: %v", err, test.wantErr)
+			}
+			if count := server.requestCount(); count != test.wantRequests {
+				t.Errorf("%d requests, want %d", count, test.wantRequests)
+			}
+		})
+	}
+}
+
+// counts the requests that go through it
+type countingTransport struct {
+	mutex sync.Mutex
+	count int
+}
+
+func (transport *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport.mutex.Lock()
+	transport.count++
+	transport.mutex.Unlock()
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestFetchClientAndTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := newFetchServer(t, func(writer http.ResponseWriter, request *http.Request, count int) {
+		select {
+		case <-release:
+		case <-request.Context().Done():
+		}
+	})
+	defer close(release)
+
+	transport := &countingTransport{}
+	options := testFetchOptions
+	options.Client = &http.Client{Transport: transport}
+	options.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := fetchValue(t, server.URL, options)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("error %v, want the timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %v with a %v timeout", elapsed, options.Timeout)
+	}
+	if transport.count != options.MaxRetries {
+		t.Errorf("%d requests through the client, want %d", transport.count, options.MaxRetries)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	options := FetchOptions{BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}.withDefaults()
+
+	for attempt := range 70 {
+		full := options.MaxDelay
+		if attempt < 5 {
+			full = options.BaseDelay << attempt
+		}
+		for range 20 {
+			if delay := backoffDelay(attempt, options); delay < full/2 || delay > full {
+				t.Fatalf("attempt %d: %v, want between %v and %v", attempt, delay, full/2, full)
+			}
+		}
+	}
+}
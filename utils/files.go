@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// writes data to path so that the file is either the old one or the new one, never half written, even if the machine crashes.
+// The data goes into a temporary file in the same directory, is synced to disk, and the temporary file is renamed over path.
+// Missing directories are created
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	//if anything goes wrong the temporary file goes, once it's renamed this does nothing
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync() //without this the rename can reach the disk before the data does
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(temp.Name(), perm)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(temp.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	//the rename itself is only on disk once the directory is synced, not every system can sync a directory though
+	if dirFile, err := os.Open(dir); err == nil {
+		dirFile.Sync()
+		dirFile.Close()
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data", "file.json")
+
+	for _, content := range []string{"first", "second, longer than the first"} {
+		if err := WriteFileAtomic(path, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != content {
+			t.Fatalf("read %q, %v, want %q", data, err, content)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode %v, want 0640", info.Mode().Perm())
+	}
+
+	//no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files in the directory, want 1", len(entries))
+	}
+
+	//a failed write leaves the old file alone
+	if err := WriteFileAtomic(filepath.Join(path, "below a file"), []byte("third"), 0640); err == nil {
+		t.Error("wrote below a file")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "second, longer than the first" {
+		t.Errorf("read %q after a failed write", data)
+	}
+}
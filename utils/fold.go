@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// letters that don't decompose into a plain letter and a diacritic, and the plain letters they're searched by.
+// Lowercase only since text is case folded first
+var foldGroups = map[string]string{
+	"æ":  "ae",
+	"đð": "d",
+	"ħ":  "h",
+	"ı":  "i",
+	"ĳ":  "ij",
+	"ĸ":  "k",
+	"ŀł": "l",
+	"ŉ":  "n",
+	"ø":  "o",
+	"œ":  "oe",
+	"ŧ":  "t",
+	"þ":  "th",
+}
+
+var foldTable = makeFoldTable()
+
+func makeFoldTable() map[rune]string {
+	table := map[rune]string{}
+	for letters, plain := range foldGroups {
+		for _, letter := range letters {
+			table[letter] = plain
+		}
+	}
+	return table
+}
+
+// case folds text and strips the diacritics off its letters, so differently written forms of a word compare equal,
+// "Motörhead" is found by "motorhead" and "Straße" by "strasse".
+// Text is decomposed first, so precomposed ("ö") and decomposed ("o" followed by U+0308) letters fold the same
+func FoldText(s string) string {
+	//plain ASCII only needs lowercasing, and most text is
+	if isASCII(s) {
+		return strings.ToLower(s)
+	}
+
+	//a Caser keeps state, so every call gets its own
+	stripped, _, err := transform.String(transform.Chain(cases.Fold(), norm.NFD, runes.Remove(runes.In(unicode.Mn))), s)
+	if err != nil {
+		stripped = strings.ToLower(s)
+	}
+
+	var builder strings.Builder
+	for _, r := range stripped {
+		if plain, ok := foldTable[r]; ok {
+			builder.WriteString(plain)
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package utils
+
+import "testing"
+
+func TestFoldText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Motörhead", "motorhead"},
+		{"São Paulo", "sao paulo"},
+		{"Straße", "strasse"},
+		{"STRASSE", "strasse"},
+		{"Beyoncé", "beyonce"},
+		{"Sigur Rós", "sigur ros"},
+		{"Mo\u0308tley Cru\u0308e", "motley crue"},       // decomposed diaeresis
+		{"Bucures\u0326ti", "bucuresti"},                 // decomposed comma below
+		{"Timișoara, Constanța", "timisoara, constanta"}, // precomposed comma below
+		{"Phở, Nguyễn, Hà Nội", "pho, nguyen, ha noi"},
+		{"Sơn Tùng, Quảng Trị", "son tung, quang tri"},
+		{"Bjørk, Łódź", "bjork, lodz"},
+		{"Ænima", "aenima"},
+		{"1987", "1987"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := FoldText(test.text); got != test.want {
+			t.Errorf("FoldText(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}